@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// secret access modes: whether the webhook reads Secrets referenced by pod env
+const (
+	// secretAccessRead Secrets referenced with secretRef and secretKeyRef are read to look for secret references
+	secretAccessRead = "read"
+	// secretAccessNone Secrets are never read; pods that keep secret references in Secrets must request injection
+	secretAccessNone = "none"
+)
+
+// injectAnnotation pod annotation requesting secrets-init for containers with env from Secrets,
+// when the webhook does not read Secrets
+const injectAnnotation = annotationPrefix + "inject"
+
+// ErrInvalidSecretAccess unknown secret access mode
+var ErrInvalidSecretAccess = errors.New("invalid secret access mode")
+
+func isSecretAccess(mode string) bool {
+	return mode == secretAccessRead || mode == secretAccessNone
+}
+
+// parseSecretAccessNamespaces parses <namespace>=<mode> values into per namespace secret access modes
+func parseSecretAccessNamespaces(values []string) (map[string]string, error) {
+	modes := map[string]string{}
+	for _, value := range values {
+		ns, mode, ok := strings.Cut(value, "=")
+		if !ok || ns == "" || !isSecretAccess(mode) {
+			return nil, errors.Wrapf(ErrInvalidSecretAccess, "expected <namespace>=read|none, got %q", value)
+		}
+		modes[ns] = mode
+	}
+	return modes, nil
+}
+
+// canReadSecrets checks whether the webhook reads Secrets in the namespace
+func (mw *mutatingWebhook) canReadSecrets(ns string) bool {
+	if mode, ok := mw.secretAccessNamespaces[ns]; ok {
+		return mode != secretAccessNone
+	}
+	return mw.secretAccess != secretAccessNone
+}
+
+// injectRequested checks pod requests secrets-init with the inject annotation
+func injectRequested(pod *corev1.Pod) bool {
+	inject, err := strconv.ParseBool(pod.Annotations[injectAnnotation])
+	return err == nil && inject
+}
+
+// splitHiddenEnvVars drops env vars from Secrets the webhook did not read; reports whether there were any
+func splitHiddenEnvVars(envVars []secretEnvVar) ([]secretEnvVar, bool) {
+	var visible []secretEnvVar
+	var hidden bool
+	for _, env := range envVars {
+		if env.Hidden {
+			hidden = true
+			continue
+		}
+		visible = append(visible, env)
+	}
+	return visible, hidden
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_mutateContainers_secretAccess(t *testing.T) {
+	secretKeyRef := corev1.EnvVar{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}, Key: "password"}}}
+	secretRef := corev1.EnvFromSource{SecretRef: &corev1.SecretEnvSource{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}}}
+	injectPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{injectAnnotation: "true"}}}
+	tests := []struct {
+		name         string
+		secretAccess string
+		namespaces   map[string]string
+		pod          *corev1.Pod
+		container    corev1.Container
+		mutated      bool
+		wantArgs     []string
+		wantReads    bool
+	}{
+		{
+			name:         "read secrets",
+			secretAccess: secretAccessRead,
+			pod:          &corev1.Pod{},
+			container:    corev1.Container{Env: []corev1.EnvVar{secretKeyRef}},
+			mutated:      true,
+			wantArgs:     []string{"--provider=aws", "echo"},
+			wantReads:    true,
+		},
+		{
+			name:         "no secret access, skip env from secret without inject annotation",
+			secretAccess: secretAccessNone,
+			pod:          &corev1.Pod{},
+			container:    corev1.Container{Env: []corev1.EnvVar{secretKeyRef}},
+		},
+		{
+			name:         "no secret access, inject env from secret key with annotation",
+			secretAccess: secretAccessNone,
+			pod:          injectPod,
+			container:    corev1.Container{Env: []corev1.EnvVar{secretKeyRef}},
+			mutated:      true,
+			wantArgs:     []string{"--provider=google", "echo"},
+		},
+		{
+			name:         "no secret access, inject env from secret with annotation",
+			secretAccess: secretAccessNone,
+			pod:          injectPod,
+			container:    corev1.Container{EnvFrom: []corev1.EnvFromSource{secretRef}},
+			mutated:      true,
+			wantArgs:     []string{"--provider=google", "echo"},
+		},
+		{
+			name:         "no secret access, inline reference",
+			secretAccess: secretAccessNone,
+			pod:          &corev1.Pod{},
+			container: corev1.Container{Env: []corev1.EnvVar{
+				secretKeyRef,
+				{Name: "API_KEY", Value: testSecretARN},
+			}},
+			mutated:  true,
+			wantArgs: []string{"--provider=aws", "echo"},
+		},
+		{
+			name:         "no secret access, inline reference overridden with env from secret key",
+			secretAccess: secretAccessNone,
+			pod:          &corev1.Pod{},
+			container: corev1.Container{Env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				secretKeyRef,
+			}},
+		},
+		{
+			name:         "no secret access in namespace",
+			secretAccess: secretAccessRead,
+			namespaces:   map[string]string{"test-ns": secretAccessNone},
+			pod:          &corev1.Pod{},
+			container:    corev1.Container{Env: []corev1.EnvVar{secretKeyRef}},
+		},
+		{
+			name:         "secret access in namespace",
+			secretAccess: secretAccessNone,
+			namespaces:   map[string]string{"test-ns": secretAccessRead},
+			pod:          &corev1.Pod{},
+			container:    corev1.Container{Env: []corev1.EnvVar{secretKeyRef}},
+			mutated:      true,
+			wantArgs:     []string{"--provider=aws", "echo"},
+			wantReads:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(makeSecret("test-ns", "test-secret", map[string][]byte{
+				"password": []byte(testSecretARN),
+			}))
+			mw := &mutatingWebhook{
+				k8sClient:              client,
+				registry:               &MockRegistry{Image: v1.Config{}},
+				provider:               "google",
+				volumeName:             binVolumeName,
+				volumePath:             binVolumePath,
+				secretAccess:           tt.secretAccess,
+				secretAccessNamespaces: tt.namespaces,
+			}
+			container := tt.container
+			container.Name = "app"
+			container.Command = []string{"echo"}
+			containers := []corev1.Container{container}
+
+			mutated, _, err := mw.mutateContainers(context.TODO(), containers, tt.pod, "test-ns")
+			if err != nil {
+				t.Fatalf("mutatingWebhook.mutateContainers() error = %v", err)
+			}
+			if mutated != tt.mutated {
+				t.Errorf("mutatingWebhook.mutateContainers() = %v, want %v", mutated, tt.mutated)
+			}
+			if tt.mutated && !reflect.DeepEqual(containers[0].Args, tt.wantArgs) {
+				t.Errorf("container args = %v, want %v", containers[0].Args, tt.wantArgs)
+			}
+			if reads := countGets(client, "secrets") > 0; reads != tt.wantReads {
+				t.Errorf("mutatingWebhook.mutateContainers() read secrets = %v, want %v", reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func Test_parseSecretAccessNamespaces(t *testing.T) {
+	got, err := parseSecretAccessNamespaces([]string{"team-a=read", "team-b=none"})
+	if err != nil {
+		t.Fatalf("parseSecretAccessNamespaces() error = %v", err)
+	}
+	if want := map[string]string{"team-a": secretAccessRead, "team-b": secretAccessNone}; !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSecretAccessNamespaces() = %v, want %v", got, want)
+	}
+	for _, value := range []string{"team-a", "=read", "team-a=write"} {
+		if _, err = parseSecretAccessNamespaces([]string{value}); err == nil {
+			t.Errorf("parseSecretAccessNamespaces(%q) expected error", value)
+		}
+	}
+}
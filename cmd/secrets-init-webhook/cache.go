@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+)
+
+// objectCache serves ConfigMap and Secret lookups from shared informers, once synced;
+// objects outside of watched namespaces or label selector are not cached
+type objectCache struct {
+	factories  []informers.SharedInformerFactory
+	configMaps map[string]corelisters.ConfigMapLister
+	secrets    map[string]corelisters.SecretLister
+	synced     atomic.Bool
+}
+
+// newObjectCache creates informers for ConfigMaps and Secrets (unless secrets is false) in the specified namespaces
+// (all namespaces, if empty), optionally limited with label selector
+func newObjectCache(client kubernetes.Interface, namespaces []string, labelSelector string, secrets bool) *objectCache {
+	if len(namespaces) == 0 {
+		namespaces = []string{metav1.NamespaceAll}
+	}
+	c := &objectCache{
+		configMaps: map[string]corelisters.ConfigMapLister{},
+		secrets:    map[string]corelisters.SecretLister{},
+	}
+	for _, ns := range namespaces {
+		factory := informers.NewSharedInformerFactoryWithOptions(client, 0,
+			informers.WithNamespace(ns),
+			informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+				options.LabelSelector = labelSelector
+			}),
+		)
+		c.configMaps[ns] = factory.Core().V1().ConfigMaps().Lister()
+		if secrets {
+			c.secrets[ns] = factory.Core().V1().Secrets().Lister()
+		}
+		c.factories = append(c.factories, factory)
+	}
+	return c
+}
+
+// start starts informers and waits for cache sync in background; lookups fall back to API server until synced.
+// Informers are stopped if cache is not synced within sync timeout (e.g. missing list and watch permissions):
+// all objects are read from API server then
+func (c *objectCache) start(stopCh <-chan struct{}, syncTimeout time.Duration) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-stopCh
+		cancel()
+	}()
+	for _, factory := range c.factories {
+		factory.Start(ctx.Done())
+	}
+	go func() {
+		syncCtx, syncCancel := context.WithTimeout(ctx, syncTimeout)
+		defer syncCancel()
+		for _, factory := range c.factories {
+			for informer, synced := range factory.WaitForCacheSync(syncCtx.Done()) {
+				if !synced {
+					logger.WithField("informer", informer.String()).Warnf("object cache not synced in %s, read objects from API server", syncTimeout)
+					cancel()
+					return
+				}
+			}
+		}
+		c.synced.Store(true)
+		logger.Debug("object cache synced")
+	}()
+}
+
+// configMap returns cached ConfigMap; false if ConfigMap is not in cache
+func (c *objectCache) configMap(ns, name string) (*corev1.ConfigMap, bool) {
+	if !c.synced.Load() {
+		return nil, false
+	}
+	lister, ok := c.configMaps[ns]
+	if !ok {
+		if lister, ok = c.configMaps[metav1.NamespaceAll]; !ok {
+			return nil, false
+		}
+	}
+	configMap, err := lister.ConfigMaps(ns).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return configMap, true
+}
+
+// secret returns cached Secret; false if Secret is not in cache
+func (c *objectCache) secret(ns, name string) (*corev1.Secret, bool) {
+	if !c.synced.Load() {
+		return nil, false
+	}
+	lister, ok := c.secrets[ns]
+	if !ok {
+		if lister, ok = c.secrets[metav1.NamespaceAll]; !ok {
+			return nil, false
+		}
+	}
+	secret, err := lister.Secrets(ns).Get(name)
+	if err != nil {
+		return nil, false
+	}
+	return secret, true
+}
+
+type configMapResult struct {
+	data map[string]string
+	err  error
+}
+
+type secretResult struct {
+	data map[string][]byte
+	err  error
+}
+
+type serviceAccountResult struct {
+	annotations map[string]string
+	err         error
+}
+
+// admissionObjects ConfigMaps, Secrets and ServiceAccounts read during a single admission, keyed by <namespace>/<name>
+type admissionObjects struct {
+	configMaps      map[string]configMapResult
+	secrets         map[string]secretResult
+	serviceAccounts map[string]serviceAccountResult
+}
+
+type admissionObjectsKey struct{}
+
+// withAdmissionObjects returns context that makes every ConfigMap, Secret and ServiceAccount to be read only once
+func withAdmissionObjects(ctx context.Context) context.Context {
+	return context.WithValue(ctx, admissionObjectsKey{}, &admissionObjects{
+		configMaps:      map[string]configMapResult{},
+		secrets:         map[string]secretResult{},
+		serviceAccounts: map[string]serviceAccountResult{},
+	})
+}
+
+func admissionObjectsFrom(ctx context.Context) *admissionObjects {
+	objects, _ := ctx.Value(admissionObjectsKey{}).(*admissionObjects)
+	return objects
+}
+
+func (mw *mutatingWebhook) getDataFromConfigmap(ctx context.Context, cmName, ns string) (map[string]string, error) {
+	key := ns + "/" + cmName
+	objects := admissionObjectsFrom(ctx)
+	if objects != nil {
+		if result, ok := objects.configMaps[key]; ok {
+			return result.data, result.err
+		}
+	}
+	data, err := mw.readConfigmap(ctx, cmName, ns)
+	if objects != nil {
+		objects.configMaps[key] = configMapResult{data: data, err: err}
+	}
+	return data, err
+}
+
+func (mw *mutatingWebhook) readConfigmap(ctx context.Context, cmName, ns string) (map[string]string, error) {
+	if err := mw.checkObjectAccess(ctx, corev1.Resource("configmaps"), cmName, ns); err != nil {
+		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, cmName)
+	}
+	// cached objects are not readable with impersonating client
+	if mw.objects != nil && mw.objectAccess != objectAccessImpersonate {
+		if configMap, ok := mw.objects.configMap(ns, cmName); ok {
+			return configMap.Data, nil
+		}
+	}
+	client, err := mw.objectClient(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, cmName)
+	}
+	configMap, err := client.CoreV1().ConfigMaps(ns).Get(ctx, cmName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, cmName)
+	}
+	return configMap.Data, nil
+}
+
+func (mw *mutatingWebhook) getDataFromSecret(ctx context.Context, secretName, ns string) (map[string][]byte, error) {
+	key := ns + "/" + secretName
+	objects := admissionObjectsFrom(ctx)
+	if objects != nil {
+		if result, ok := objects.secrets[key]; ok {
+			return result.data, result.err
+		}
+	}
+	data, err := mw.readSecret(ctx, secretName, ns)
+	if objects != nil {
+		objects.secrets[key] = secretResult{data: data, err: err}
+	}
+	return data, err
+}
+
+func (mw *mutatingWebhook) readSecret(ctx context.Context, secretName, ns string) (map[string][]byte, error) {
+	if err := mw.checkObjectAccess(ctx, corev1.Resource("secrets"), secretName, ns); err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s/%s", ns, secretName)
+	}
+	// cached objects are not readable with impersonating client
+	if mw.objects != nil && mw.objectAccess != objectAccessImpersonate {
+		if secret, ok := mw.objects.secret(ns, secretName); ok {
+			return secret.Data, nil
+		}
+	}
+	client, err := mw.objectClient(ctx)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s/%s", ns, secretName)
+	}
+	secret, err := client.CoreV1().Secrets(ns).Get(ctx, secretName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get secret %s/%s", ns, secretName)
+	}
+	return secret.Data, nil
+}
+
+// getServiceAccountAnnotations returns annotations of the pod ServiceAccount; the ServiceAccount is read with
+// webhook permissions, once per admission
+func (mw *mutatingWebhook) getServiceAccountAnnotations(ctx context.Context, saName, ns string) (map[string]string, error) {
+	key := ns + "/" + saName
+	objects := admissionObjectsFrom(ctx)
+	if objects != nil {
+		if result, ok := objects.serviceAccounts[key]; ok {
+			return result.annotations, result.err
+		}
+	}
+	var annotations map[string]string
+	sa, err := mw.k8sClient.CoreV1().ServiceAccounts(ns).Get(ctx, saName, metav1.GetOptions{})
+	if err != nil {
+		err = errors.Wrapf(err, "failed to get service account %s/%s", ns, saName)
+	} else {
+		annotations = sa.Annotations
+	}
+	if objects != nil {
+		objects.serviceAccounts[key] = serviceAccountResult{annotations: annotations, err: err}
+	}
+	return annotations, err
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// helper function - count API server GET requests for resource
+func countGets(client *fake.Clientset, resource string) int {
+	var count int
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == resource {
+			count++
+		}
+	}
+	return count
+}
+
+// helper function - start object cache and wait for it to sync
+func startObjectCache(t *testing.T, c *objectCache) {
+	stopCh := make(chan struct{})
+	t.Cleanup(func() { close(stopCh) })
+	c.start(stopCh, time.Minute)
+	for deadline := time.Now().Add(10 * time.Second); !c.synced.Load(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("object cache not synced")
+		}
+	}
+}
+
+func Test_mutatingWebhook_getData_objectCache(t *testing.T) {
+	labeled := makeConfigMap("test-ns", "labeled", map[string]string{"key": "labeled"})
+	labeled.Labels = map[string]string{"secrets-init": "true"}
+	tests := []struct {
+		name          string
+		namespaces    []string
+		labelSelector string
+		configMap     string
+		want          map[string]string
+		wantGets      int
+	}{
+		{
+			name:      "all namespaces, served from cache",
+			configMap: "plain",
+			want:      map[string]string{"key": "plain"},
+		},
+		{
+			name:       "watched namespace, served from cache",
+			namespaces: []string{"test-ns"},
+			configMap:  "plain",
+			want:       map[string]string{"key": "plain"},
+		},
+		{
+			name:       "not watched namespace, fall back to API server",
+			namespaces: []string{"other-ns"},
+			configMap:  "plain",
+			want:       map[string]string{"key": "plain"},
+			wantGets:   1,
+		},
+		{
+			name:          "matching label selector, served from cache",
+			labelSelector: "secrets-init=true",
+			configMap:     "labeled",
+			want:          map[string]string{"key": "labeled"},
+		},
+		{
+			name:          "not matching label selector, fall back to API server",
+			labelSelector: "secrets-init=true",
+			configMap:     "plain",
+			want:          map[string]string{"key": "plain"},
+			wantGets:      1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				makeConfigMap("test-ns", "plain", map[string]string{"key": "plain"}),
+				labeled,
+			)
+			objects := newObjectCache(client, tt.namespaces, tt.labelSelector, true)
+			startObjectCache(t, objects)
+			client.ClearActions()
+
+			mw := &mutatingWebhook{k8sClient: client, objects: objects}
+			got, err := mw.getDataFromConfigmap(context.TODO(), tt.configMap, "test-ns")
+			if err != nil {
+				t.Fatalf("mutatingWebhook.getDataFromConfigmap() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mutatingWebhook.getDataFromConfigmap() = %v, want %v", got, tt.want)
+			}
+			if gets := countGets(client, "configmaps"); gets != tt.wantGets {
+				t.Errorf("mutatingWebhook.getDataFromConfigmap() API server GETs = %d, want %d", gets, tt.wantGets)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_buildContainerEnv_readsObjectsOnce(t *testing.T) {
+	optional := true
+	client := fake.NewSimpleClientset(
+		makeSecret("test-ns", "test-secret", map[string][]byte{"password": []byte(testSecretARN)}),
+	)
+	mw := &mutatingWebhook{k8sClient: client}
+	envFrom := []corev1.EnvFromSource{
+		{SecretRef: &corev1.SecretEnvSource{LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}}},
+	}
+	env := []corev1.EnvVar{
+		{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}, Key: "password"}}},
+		{Name: "OPTIONAL", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: "missing"}, Key: "password", Optional: &optional}}},
+	}
+
+	ctx := withAdmissionObjects(context.TODO())
+	for i := 0; i < 2; i++ {
+		result, err := mw.buildContainerEnv(ctx, envFrom, env, "test-ns")
+		if err != nil {
+			t.Fatalf("mutatingWebhook.buildContainerEnv() error = %v", err)
+		}
+		if got := result.secretEnvVars(); len(got) != 2 {
+			t.Errorf("mutatingWebhook.buildContainerEnv() = %v, want 2 secret env vars", got)
+		}
+	}
+	if gets := countGets(client, "secrets"); gets != 2 {
+		t.Errorf("mutatingWebhook.buildContainerEnv() API server GETs = %d, want 2", gets)
+	}
+}
+
+func Test_objectCache_syncTimeout(t *testing.T) {
+	client := fake.NewSimpleClientset(makeConfigMap("test-ns", "plain", map[string]string{"key": "plain"}))
+	// webhook without list permission: informers never sync
+	client.PrependReactor("list", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewForbidden(corev1.Resource("configmaps"), "", nil)
+	})
+	objects := newObjectCache(client, nil, "", false)
+	stopCh := make(chan struct{})
+	defer close(stopCh)
+	objects.start(stopCh, 100*time.Millisecond)
+	time.Sleep(300 * time.Millisecond)
+	if objects.synced.Load() {
+		t.Fatal("object cache synced without list permission")
+	}
+
+	client.ClearActions()
+	mw := &mutatingWebhook{k8sClient: client, objects: objects}
+	got, err := mw.getDataFromConfigmap(context.TODO(), "plain", "test-ns")
+	if err != nil {
+		t.Fatalf("mutatingWebhook.getDataFromConfigmap() error = %v", err)
+	}
+	if want := map[string]string{"key": "plain"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mutatingWebhook.getDataFromConfigmap() = %v, want %v", got, want)
+	}
+	if gets := countGets(client, "configmaps"); gets != 1 {
+		t.Errorf("mutatingWebhook.getDataFromConfigmap() API server GETs = %d, want 1", gets)
+	}
+	// informers are stopped after sync timeout
+	client.ClearActions()
+	time.Sleep(1500 * time.Millisecond)
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "list" {
+			t.Fatalf("object cache informers still list after sync timeout: %v", action)
+		}
+	}
+}
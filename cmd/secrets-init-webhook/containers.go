@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// containersAnnotation comma separated names of containers to mutate; all containers, if not set
+	containersAnnotation = annotationPrefix + "containers"
+	// excludeContainersAnnotation comma separated names of containers that must not be mutated
+	excludeContainersAnnotation = annotationPrefix + "exclude-containers"
+)
+
+// splitNames splits comma separated list of names, ignoring spaces and empty names
+func splitNames(value string) []string {
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// selectContainer checks pod annotations select container for mutation; returns the decision reason
+func selectContainer(pod *corev1.Pod, name string) (bool, string) {
+	if exclude, ok := pod.Annotations[excludeContainersAnnotation]; ok && contains(splitNames(exclude), name) {
+		return false, "excluded with " + excludeContainersAnnotation
+	}
+	if include, ok := pod.Annotations[containersAnnotation]; ok {
+		if contains(splitNames(include), name) {
+			return true, "included with " + containersAnnotation
+		}
+		return false, "not listed in " + containersAnnotation
+	}
+	return true, ""
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_mutatingWebhook_mutatePod_containerSelection(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+	}{
+		{
+			name: "all containers",
+			want: []string{"init", "app", "proxy", "logger"},
+		},
+		{
+			name:        "include containers",
+			annotations: map[string]string{containersAnnotation: "app, init"},
+			want:        []string{"init", "app"},
+		},
+		{
+			name:        "exclude containers",
+			annotations: map[string]string{excludeContainersAnnotation: "proxy,logger"},
+			want:        []string{"init", "app"},
+		},
+		{
+			name:        "exclude included container",
+			annotations: map[string]string{containersAnnotation: "app,proxy", excludeContainersAnnotation: "proxy"},
+			want:        []string{"app"},
+		},
+		{
+			name:        "no listed containers",
+			annotations: map[string]string{containersAnnotation: "unknown"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:  fake.NewSimpleClientset(),
+				registry:   &MockRegistry{Image: v1.Config{}},
+				provider:   "aws",
+				image:      secretsInitImage,
+				volumeName: binVolumeName,
+				volumePath: binVolumePath,
+			}
+			container := func(name string) corev1.Container {
+				return corev1.Container{
+					Name:    name,
+					Command: []string{name},
+					Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}},
+				}
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Annotations: tt.annotations},
+				Spec: corev1.PodSpec{
+					InitContainers: []corev1.Container{container("init")},
+					Containers:     []corev1.Container{container("app"), container("proxy"), container("logger")},
+				},
+			}
+
+			if _, err := mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+			}
+			var mutated []string
+			for _, c := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+				if c.Name == "copy-secrets-init" {
+					continue
+				}
+				switch {
+				case c.Command[0] == binVolumePath+"/secrets-init" && len(c.VolumeMounts) == 1:
+					mutated = append(mutated, c.Name)
+				case !reflect.DeepEqual(c.Command, []string{c.Name}) || len(c.VolumeMounts) != 0 || len(c.Args) != 0:
+					t.Errorf("container %s is changed: %+v", c.Name, c)
+				}
+			}
+			if !reflect.DeepEqual(mutated, tt.want) {
+				t.Errorf("mutated containers = %v, want %v", mutated, tt.want)
+			}
+			if injected := len(pod.Spec.Volumes) != 0; injected != (len(tt.want) != 0) {
+				t.Errorf("secrets-init volume injected = %v, want %v", injected, len(tt.want) != 0)
+			}
+		})
+	}
+}
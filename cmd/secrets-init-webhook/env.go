@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// fieldEnvSource is the source of env var set from pod field or container resource
+const fieldEnvSource = "field or resource reference"
+
+// containerEnv is container environment built the way kubelet builds it
+type containerEnv struct {
+	names   []string
+	values  map[string]string
+	sources map[string]string
+	// hidden env vars from Secrets the webhook does not read
+	hidden map[string]bool
+	// hiddenFrom envFrom Secrets the webhook does not read
+	hiddenFrom []string
+}
+
+func newContainerEnv() *containerEnv {
+	return &containerEnv{values: map[string]string{}, sources: map[string]string{}, hidden: map[string]bool{}}
+}
+
+// set defines or overrides env var; order of first definition is kept
+func (e *containerEnv) set(name, value, source string) {
+	if _, ok := e.values[name]; !ok {
+		e.names = append(e.names, name)
+	}
+	e.values[name] = value
+	e.sources[name] = source
+	delete(e.hidden, name)
+}
+
+// setHidden defines or overrides env var with unknown value from Secret
+func (e *containerEnv) setHidden(name, source string) {
+	e.set(name, "", source)
+	e.hidden[name] = true
+}
+
+// expand expands $(VAR) references to previously defined env vars, like kubelet does for env values:
+// $$ is an escaped $, and references to undefined variables are left as is
+func (e *containerEnv) expand(value string) string {
+	var sb strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case '$':
+			sb.WriteByte('$')
+			i++
+		case '(':
+			end := strings.IndexByte(value[i+2:], ')')
+			if end < 0 {
+				sb.WriteString(value[i:])
+				return sb.String()
+			}
+			name := value[i+2 : i+2+end]
+			if v, ok := e.values[name]; ok {
+				sb.WriteString(v)
+			} else {
+				sb.WriteString(value[i : i+end+3])
+			}
+			i += end + 2
+		default:
+			sb.WriteByte('$')
+		}
+	}
+	return sb.String()
+}
+
+// secretEnvVars returns effective env vars that reference secrets, in definition order
+func (e *containerEnv) secretEnvVars() []secretEnvVar {
+	var envVars []secretEnvVar
+	for _, name := range e.names {
+		if e.hidden[name] {
+			envVars = append(envVars, secretEnvVar{EnvVar: corev1.EnvVar{Name: name}, Source: e.sources[name], Hidden: true})
+			continue
+		}
+		if env := lookupSecretEnvVar(name, e.values[name], e.sources[name]); env != nil {
+			envVars = append(envVars, *env)
+		}
+	}
+	for _, source := range e.hiddenFrom {
+		envVars = append(envVars, secretEnvVar{Source: source, Hidden: true})
+	}
+	return envVars
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
+
+// defines checks env var may be defined in container environment; names from envFrom Secrets the webhook
+// does not read are not known, so any env var may be defined then
+func (e *containerEnv) defines(name string) bool {
+	_, ok := e.values[name]
+	return ok || len(e.hiddenFrom) > 0
+}
+
+// buildContainerEnv builds container environment following kubelet rules:
+// envFrom sources are applied in order (with prefix; keys that are not valid env var names are skipped),
+// then env entries override them in order; missing optional ConfigMaps, Secrets and keys are skipped
+func (mw *mutatingWebhook) buildContainerEnv(ctx context.Context, envFrom []corev1.EnvFromSource, env []corev1.EnvVar, ns string) (*containerEnv, error) {
+	result := newContainerEnv()
+
+	for _, ef := range envFrom {
+		if err := mw.applyEnvFrom(ctx, result, ef, ns); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, e := range env {
+		switch {
+		case e.Value != "":
+			result.set(e.Name, result.expand(e.Value), inlineEnvSource)
+		case e.ValueFrom == nil:
+			result.set(e.Name, "", inlineEnvSource)
+		case e.ValueFrom.SecretKeyRef != nil && !mw.canReadSecrets(ns):
+			ref := e.ValueFrom.SecretKeyRef
+			result.setHidden(e.Name, secretKeySource(ns, ref.Name, ref.Key))
+		case e.ValueFrom.ConfigMapKeyRef != nil || e.ValueFrom.SecretKeyRef != nil:
+			value, source, err := mw.valueFromKeyRef(ctx, e.ValueFrom, ns)
+			if errors.Is(err, ErrNoValue) {
+				// kubelet keeps previous value, if optional key reference is missing
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			result.set(e.Name, value, source)
+		default:
+			result.set(e.Name, "", fieldEnvSource)
+		}
+	}
+
+	return result, nil
+}
+
+// applyEnvFrom adds env vars from ConfigMap or Secret envFrom source
+func (mw *mutatingWebhook) applyEnvFrom(ctx context.Context, result *containerEnv, ef corev1.EnvFromSource, ns string) error {
+	data := map[string]string{}
+	var sourceFunc func(key string) string
+	switch {
+	case ef.ConfigMapRef != nil:
+		cmData, err := mw.getDataFromConfigmap(ctx, ef.ConfigMapRef.Name, ns)
+		if err != nil {
+			if apierrors.IsNotFound(errors.Cause(err)) && isOptional(ef.ConfigMapRef.Optional) {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to look for envFrom configmap %s/%s", ns, ef.ConfigMapRef.Name)
+		}
+		data = cmData
+		sourceFunc = func(key string) string { return configMapKeySource(ns, ef.ConfigMapRef.Name, key) }
+	case ef.SecretRef != nil && !mw.canReadSecrets(ns):
+		result.hiddenFrom = append(result.hiddenFrom, fmt.Sprintf("secret %s/%s", ns, ef.SecretRef.Name))
+		return nil
+	case ef.SecretRef != nil:
+		secretData, err := mw.getDataFromSecret(ctx, ef.SecretRef.Name, ns)
+		if err != nil {
+			if apierrors.IsNotFound(errors.Cause(err)) && isOptional(ef.SecretRef.Optional) {
+				return nil
+			}
+			return errors.Wrapf(err, "failed to look for envFrom secret %s/%s", ns, ef.SecretRef.Name)
+		}
+		for key, value := range secretData {
+			data[key] = string(value)
+		}
+		sourceFunc = func(key string) string { return secretKeySource(ns, ef.SecretRef.Name, key) }
+	default:
+		return nil
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := ef.Prefix + key
+		if len(validation.IsEnvVarName(name)) != 0 {
+			// kubelet skips invalid keys
+			continue
+		}
+		result.set(name, data[key], sourceFunc(key))
+	}
+	return nil
+}
+
+// valueFromKeyRef returns value of ConfigMap or Secret key reference;
+// returns ErrNoValue if optional ConfigMap, Secret or key is missing
+func (mw *mutatingWebhook) valueFromKeyRef(ctx context.Context, valueFrom *corev1.EnvVarSource, ns string) (string, string, error) {
+	if ref := valueFrom.ConfigMapKeyRef; ref != nil {
+		data, err := mw.getDataFromConfigmap(ctx, ref.Name, ns)
+		if err != nil {
+			if apierrors.IsNotFound(errors.Cause(err)) && isOptional(ref.Optional) {
+				return "", "", ErrNoValue
+			}
+			return "", "", errors.Wrapf(err, "failed to look for valueFrom configmap %s/%s", ns, ref.Name)
+		}
+		value, ok := data[ref.Key]
+		if !ok {
+			// missing non-optional key fails container start; there is nothing to resolve
+			return "", "", ErrNoValue
+		}
+		return value, configMapKeySource(ns, ref.Name, ref.Key), nil
+	}
+	ref := valueFrom.SecretKeyRef
+	data, err := mw.getDataFromSecret(ctx, ref.Name, ns)
+	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) && isOptional(ref.Optional) {
+			return "", "", ErrNoValue
+		}
+		return "", "", errors.Wrapf(err, "failed to look for valueFrom secret %s/%s", ns, ref.Name)
+	}
+	value, ok := data[ref.Key]
+	if !ok {
+		return "", "", ErrNoValue
+	}
+	return string(value), secretKeySource(ns, ref.Name, ref.Key), nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_buildContainerEnv(t *testing.T) {
+	optional := true
+	cmEnvFrom := func(name, prefix string, opt bool) corev1.EnvFromSource {
+		return corev1.EnvFromSource{Prefix: prefix, ConfigMapRef: &corev1.ConfigMapEnvSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name}, Optional: &opt}}
+	}
+	secretKeyRef := func(name, key string, opt bool) *corev1.EnvVarSource {
+		return &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+			LocalObjectReference: corev1.LocalObjectReference{Name: name}, Key: key, Optional: &opt}}
+	}
+	client := func() kubernetes.Interface {
+		return fake.NewSimpleClientset(
+			makeConfigMap("test-ns", "cm", map[string]string{
+				"PASSWORD": testSecretARN,
+				"1INVALID": testSecretARN,
+				"TEXT":     "plain",
+			}),
+			makeConfigMap("test-ns", "cm-override", map[string]string{
+				"PASSWORD": "plain",
+			}),
+			makeSecret("test-ns", "secret", map[string][]byte{
+				"password": []byte(testSecretARN),
+			}),
+		)
+	}
+	tests := []struct {
+		name    string
+		envFrom []corev1.EnvFromSource
+		env     []corev1.EnvVar
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:    "envFrom invalid keys skipped",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("cm", "", false)},
+			want:    map[string]string{"PASSWORD": configMapKeySource("test-ns", "cm", "PASSWORD")},
+		},
+		{
+			name:    "envFrom prefix",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("cm", "APP_", false)},
+			want: map[string]string{
+				"APP_PASSWORD": configMapKeySource("test-ns", "cm", "PASSWORD"),
+				"APP_1INVALID": configMapKeySource("test-ns", "cm", "1INVALID"),
+			},
+		},
+		{
+			name:    "later envFrom overrides earlier",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("cm", "", false), cmEnvFrom("cm-override", "", false)},
+			want:    map[string]string{},
+		},
+		{
+			name:    "env overrides envFrom",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("cm", "", false)},
+			env:     []corev1.EnvVar{{Name: "PASSWORD", Value: "plain"}},
+			want:    map[string]string{},
+		},
+		{
+			name:    "env secret reference overrides envFrom",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("cm-override", "", false)},
+			env:     []corev1.EnvVar{{Name: "PASSWORD", ValueFrom: secretKeyRef("secret", "password", false)}},
+			want:    map[string]string{"PASSWORD": secretKeySource("test-ns", "secret", "password")},
+		},
+		{
+			name: "duplicate env, last definition wins",
+			env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: "PASSWORD", Value: "plain"},
+			},
+			want: map[string]string{},
+		},
+		{
+			name: "field reference overrides secret reference",
+			env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{FieldRef: &corev1.ObjectFieldSelector{FieldPath: "metadata.name"}}},
+			},
+			want: map[string]string{},
+		},
+		{
+			name:    "optional missing configmap skipped",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("missing", "", optional)},
+			want:    map[string]string{},
+		},
+		{
+			name:    "non-optional missing configmap",
+			envFrom: []corev1.EnvFromSource{cmEnvFrom("missing", "", false)},
+			wantErr: true,
+		},
+		{
+			name: "optional missing secret keeps previous value",
+			env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: "PASSWORD", ValueFrom: secretKeyRef("missing", "password", optional)},
+			},
+			want: map[string]string{"PASSWORD": inlineEnvSource},
+		},
+		{
+			name: "optional missing key keeps previous value",
+			env: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: "PASSWORD", ValueFrom: secretKeyRef("secret", "missing", optional)},
+			},
+			want: map[string]string{"PASSWORD": inlineEnvSource},
+		},
+		{
+			name:    "non-optional missing secret",
+			env:     []corev1.EnvVar{{Name: "PASSWORD", ValueFrom: secretKeyRef("missing", "password", false)}},
+			wantErr: true,
+		},
+		{
+			name: "expanded env value references secret",
+			env: []corev1.EnvVar{
+				{Name: "ARN", Value: testSecretARN},
+				{Name: "PASSWORD", Value: "$(ARN)"},
+				{Name: "ESCAPED", Value: "$$(ARN)"},
+				{Name: "UNDEFINED", Value: "$(PASSWORD_ARN)"},
+			},
+			want: map[string]string{"ARN": inlineEnvSource, "PASSWORD": inlineEnvSource},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{k8sClient: client()}
+			result, err := mw.buildContainerEnv(context.TODO(), tt.envFrom, tt.env, "test-ns")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mutatingWebhook.buildContainerEnv() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			sources := map[string]string{}
+			for _, env := range result.secretEnvVars() {
+				if env.Value != testSecretARN {
+					t.Errorf("mutatingWebhook.buildContainerEnv() %s = %q, want %q", env.Name, env.Value, testSecretARN)
+				}
+				sources[env.Name] = env.Source
+			}
+			if !reflect.DeepEqual(sources, tt.want) {
+				t.Errorf("mutatingWebhook.buildContainerEnv() = %v, want %v", sources, tt.want)
+			}
+		})
+	}
+}
+
+func Test_containerEnv_expand(t *testing.T) {
+	env := newContainerEnv()
+	env.set("A", "a", inlineEnvSource)
+	tests := map[string]string{
+		"$(A)":       "a",
+		"x$(A)y":     "xay",
+		"$$(A)":      "$(A)",
+		"$(B)":       "$(B)",
+		"$(A":        "$(A",
+		"$A":         "$A",
+		"cost $":     "cost $",
+		"$(A)-$(A)":  "a-a",
+		"$$$(A)":     "$a",
+		"plain text": "plain text",
+	}
+	for value, want := range tests {
+		if got := env.expand(value); got != want {
+			t.Errorf("containerEnv.expand(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
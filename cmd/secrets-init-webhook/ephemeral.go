@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/pkg/errors"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ephemeralContainersMutator mutates ephemeral containers added to a running pod
+// with pods/ephemeralcontainers subresource (e.g. kubectl debug)
+func (mw *mutatingWebhook) ephemeralContainersMutator(ctx context.Context, ar *whmodel.AdmissionReview, obj metav1.Object) (*mutating.MutatorResult, error) {
+	pod, ok := obj.(*corev1.Pod)
+	if !ok {
+		return &mutating.MutatorResult{}, nil
+	}
+	oldPod := &corev1.Pod{}
+	if len(ar.OldObjectRaw) != 0 {
+		if err := json.Unmarshal(ar.OldObjectRaw, oldPod); err != nil {
+			return nil, errors.Wrapf(err, "failed to decode old pod: %s", pod.Name)
+		}
+	}
+	ctx = withAdmissionUser(withAdmissionObjects(ctx), admissionUserInfo(ar))
+	warnings, err := mw.mutateEphemeralContainers(ctx, pod, oldPod, ar.Namespace)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to mutate ephemeral containers of pod: %s", pod.Name)
+	}
+	return &mutating.MutatorResult{MutatedObject: pod, Warnings: warnings}, nil
+}
+
+// mutateEphemeralContainers wraps ephemeral containers added since old pod with secrets-init;
+// secrets-init binary is taken from the volume of earlier pod mutation, pod is not changed if there is no such volume
+func (mw *mutatingWebhook) mutateEphemeralContainers(ctx context.Context, pod, oldPod *corev1.Pod, ns string) ([]string, error) {
+	mw, err := mw.withPodOverrides(pod)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to apply annotations of pod %s", pod.Name)
+	}
+	mw.injectionMode = mw.podInjectionMode(pod, ns)
+	mw.ephemeral = true
+
+	existing := map[string]bool{}
+	for _, ec := range oldPod.Spec.EphemeralContainers {
+		existing[ec.Name] = true
+	}
+	// existing ephemeral containers cannot be changed
+	var added []int
+	var containers []corev1.Container
+	for i, ec := range pod.Spec.EphemeralContainers {
+		if !existing[ec.Name] {
+			added = append(added, i)
+			containers = append(containers, corev1.Container(ec.EphemeralContainerCommon))
+		}
+	}
+
+	osWebhook, err := mw.forOS(podOS(pod))
+	if err != nil {
+		return mw.skipNonLinux(pod, err)
+	}
+	mutated, warnings, err := osWebhook.mutateContainers(ctx, containers, pod, ns)
+	var imageErr *imageOSError
+	if errors.As(err, &imageErr) {
+		return mw.skipNonLinux(pod, err)
+	}
+	if err != nil || !mutated {
+		return warnings, err
+	}
+
+	if !osWebhook.injected(pod) {
+		logger.WithField("pod", pod.Name).Warn("pod has no secrets-init volume, skip ephemeral containers")
+		return append(warnings, fmt.Sprintf("pod %s has no secrets-init volume: ephemeral containers are not wrapped with secrets-init", pod.Name)), nil
+	}
+	for i, index := range added {
+		pod.Spec.EphemeralContainers[index].EphemeralContainerCommon = corev1.EphemeralContainerCommon(containers[i])
+	}
+	logger.Debug("successfully mutated pod ephemeral containers")
+	return warnings, nil
+}
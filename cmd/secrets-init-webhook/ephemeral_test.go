@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// helper function - make ephemeral container referencing testSecretARN
+func makeTestEphemeralContainer(name string) corev1.EphemeralContainer {
+	return corev1.EphemeralContainer{
+		EphemeralContainerCommon: corev1.EphemeralContainerCommon{
+			Name:    name,
+			Command: []string{"sh"},
+			Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}},
+		},
+		TargetContainerName: "app",
+	}
+}
+
+func Test_mutatingWebhook_ephemeralContainersMutator(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+	mutatedPod := makeTestPod()
+	if _, err := mw.mutatePod(context.TODO(), mutatedPod, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+	}
+	mutatedPod.Spec.EphemeralContainers = []corev1.EphemeralContainer{makeTestEphemeralContainer("old-debugger")}
+
+	tests := []struct {
+		name         string
+		oldPod       *corev1.Pod
+		wantWrapped  []bool
+		wantWarnings int
+	}{
+		{
+			name:        "wrap added ephemeral container",
+			oldPod:      mutatedPod,
+			wantWrapped: []bool{false, true},
+		},
+		{
+			name: "pod without secrets-init volume",
+			oldPod: func() *corev1.Pod {
+				pod := makeTestPod()
+				pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{makeTestEphemeralContainer("old-debugger")}
+				return pod
+			}(),
+			wantWrapped:  []bool{false, false},
+			wantWarnings: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oldRaw, err := json.Marshal(tt.oldPod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pod := tt.oldPod.DeepCopy()
+			pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, makeTestEphemeralContainer("debugger"))
+
+			ar := &whmodel.AdmissionReview{Namespace: "test-ns", Operation: whmodel.OperationUpdate, OldObjectRaw: oldRaw}
+			result, err := mw.ephemeralContainersMutator(context.TODO(), ar, pod)
+			if err != nil {
+				t.Fatalf("mutatingWebhook.ephemeralContainersMutator() error = %v", err)
+			}
+			if len(result.Warnings) != tt.wantWarnings {
+				t.Errorf("mutatingWebhook.ephemeralContainersMutator() warnings = %v, want %d", result.Warnings, tt.wantWarnings)
+			}
+			var wrapped []bool
+			for _, ec := range pod.Spec.EphemeralContainers {
+				container := corev1.Container(ec.EphemeralContainerCommon)
+				wrapped = append(wrapped, isWrapped(&container))
+			}
+			if !reflect.DeepEqual(wrapped, tt.wantWrapped) {
+				t.Errorf("ephemeral containers wrapped = %v, want %v", wrapped, tt.wantWrapped)
+			}
+			if !reflect.DeepEqual(pod.Spec.Containers, tt.oldPod.Spec.Containers) ||
+				!reflect.DeepEqual(pod.Spec.InitContainers, tt.oldPod.Spec.InitContainers) ||
+				!reflect.DeepEqual(pod.Spec.Volumes, tt.oldPod.Spec.Volumes) {
+				t.Errorf("mutatingWebhook.ephemeralContainersMutator() changed pod containers or volumes")
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_ephemeralContainersMutator_imageVolume(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:             fake.NewSimpleClientset(),
+		registry:              &MockRegistry{Image: v1.Config{}},
+		provider:              "aws",
+		image:                 secretsInitImage,
+		volumeName:            binVolumeName,
+		volumePath:            binVolumePath,
+		injectionMode:         injectionImageVolume,
+		imageVolumesSupported: true,
+		imageVolumeSubPath:    "usr/local/bin",
+	}
+	oldPod := makeTestPod()
+	if _, err := mw.mutatePod(context.TODO(), oldPod, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+	}
+	oldRaw, err := json.Marshal(oldPod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pod := oldPod.DeepCopy()
+	pod.Spec.EphemeralContainers = []corev1.EphemeralContainer{makeTestEphemeralContainer("debugger")}
+	ar := &whmodel.AdmissionReview{Namespace: "test-ns", Operation: whmodel.OperationUpdate, OldObjectRaw: oldRaw}
+	if _, err = mw.ephemeralContainersMutator(context.TODO(), ar, pod); err != nil {
+		t.Fatalf("mutatingWebhook.ephemeralContainersMutator() error = %v", err)
+	}
+	// reinvoked webhook keeps ephemeral container unchanged
+	want := pod.DeepCopy()
+	if _, err = mw.ephemeralContainersMutator(context.TODO(), ar, pod); err != nil {
+		t.Fatalf("mutatingWebhook.ephemeralContainersMutator() error = %v", err)
+	}
+	if !reflect.DeepEqual(pod, want) {
+		t.Errorf("reinvoked mutatingWebhook.ephemeralContainersMutator() = %+v, want %+v", pod.Spec.EphemeralContainers, want.Spec.EphemeralContainers)
+	}
+
+	// API server rejects subPath mounts of ephemeral containers: the whole image volume is mounted
+	debugger := pod.Spec.EphemeralContainers[0]
+	wantMount := corev1.VolumeMount{Name: binVolumeName, MountPath: binVolumePath, ReadOnly: true}
+	if !reflect.DeepEqual(debugger.VolumeMounts, []corev1.VolumeMount{wantMount}) {
+		t.Errorf("ephemeral container volume mounts = %+v, want %+v", debugger.VolumeMounts, wantMount)
+	}
+	if want := []string{binVolumePath + "/usr/local/bin/secrets-init"}; !reflect.DeepEqual(debugger.Command, want) {
+		t.Errorf("ephemeral container command = %v, want %v", debugger.Command, want)
+	}
+	// pod containers keep subPath mount
+	if mounts := pod.Spec.Containers[0].VolumeMounts; len(mounts) != 1 || mounts[0].SubPath != "usr/local/bin" {
+		t.Errorf("container volume mounts = %+v, want subPath usr/local/bin", mounts)
+	}
+}
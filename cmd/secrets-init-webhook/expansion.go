@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// policyRewrite rewrites secret variable expansions so secrets-init expands them after resolving secrets
+const policyRewrite = "rewrite"
+
+// ErrSecretExpansion container command or args expand a secret reference variable
+var ErrSecretExpansion = errors.New("secret reference variable expanded in command or args")
+
+// scanExpansions finds kubelet $(VAR) expansions of the given variables in value; when escape is set,
+// returns value with these expansions escaped as $$(VAR), so kubelet passes them to secrets-init untouched
+func scanExpansions(value string, names map[string]bool, escape bool) (string, []string) {
+	var sb strings.Builder
+	var found []string
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || i+1 == len(value) {
+			sb.WriteByte(value[i])
+			continue
+		}
+		switch value[i+1] {
+		case '$':
+			// $$ is an escaped $, kubelet does not expand it
+			sb.WriteString("$$")
+			i++
+		case '(':
+			end := strings.IndexByte(value[i+2:], ')')
+			if end < 0 {
+				sb.WriteString(value[i:])
+				return sb.String(), found
+			}
+			expr := value[i : i+end+3]
+			if name := expr[2 : len(expr)-1]; names[name] {
+				found = append(found, name)
+				if escape {
+					sb.WriteByte('$')
+				}
+			}
+			sb.WriteString(expr)
+			i += len(expr) - 1
+		default:
+			sb.WriteByte('$')
+		}
+	}
+	return sb.String(), found
+}
+
+// handleSecretExpansions looks for $(VAR) expansions of secret reference variables in container command and args;
+// depending on webhook configuration it rewrites them (returning secrets-init arguments), warns or denies
+func (mw *mutatingWebhook) handleSecretExpansions(container *corev1.Container, envVars []secretEnvVar) ([]string, []string, error) {
+	names := map[string]bool{}
+	for _, env := range envVars {
+		names[env.Name] = true
+	}
+
+	escape := mw.secretExpansion != policyDeny && mw.secretExpansion != policyWarn
+	expanded := map[string]bool{}
+	rewrite := func(values []string) []string {
+		if values == nil {
+			return nil
+		}
+		result := make([]string, len(values))
+		for i, value := range values {
+			var found []string
+			result[i], found = scanExpansions(value, names, escape)
+			for _, name := range found {
+				expanded[name] = true
+			}
+		}
+		return result
+	}
+	command, args := rewrite(container.Command), rewrite(container.Args)
+	if len(expanded) == 0 {
+		return nil, nil, nil
+	}
+
+	vars := make([]string, 0, len(expanded))
+	for name := range expanded {
+		vars = append(vars, name)
+	}
+	sort.Strings(vars)
+	err := errors.Wrapf(ErrSecretExpansion, "container %s: [%s]", container.Name, strings.Join(vars, ", "))
+
+	switch mw.secretExpansion {
+	case policyDeny:
+		return nil, nil, err
+	case policyWarn:
+		logger.WithError(err).Warn("secret reference variable is expanded by kubelet before secrets-init resolves it")
+		return nil, []string{err.Error()}, nil
+	default:
+		logger.WithError(err).Debug("rewrite secret reference variable expansion")
+		container.Command, container.Args = command, args
+		return []string{fmt.Sprintf("--expand-args=%s", strings.Join(vars, ","))}, nil, nil
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+func Test_scanExpansions(t *testing.T) {
+	names := map[string]bool{"DB_PASSWORD": true}
+	tests := []struct {
+		name      string
+		value     string
+		want      string
+		wantFound []string
+	}{
+		{
+			name:  "no expansion",
+			value: "--password=secret",
+			want:  "--password=secret",
+		},
+		{
+			name:      "secret expansion",
+			value:     "--password=$(DB_PASSWORD)",
+			want:      "--password=$$(DB_PASSWORD)",
+			wantFound: []string{"DB_PASSWORD"},
+		},
+		{
+			name:  "non-secret expansion",
+			value: "--user=$(DB_USER)",
+			want:  "--user=$(DB_USER)",
+		},
+		{
+			name:  "escaped expansion",
+			value: "--password=$$(DB_PASSWORD)",
+			want:  "--password=$$(DB_PASSWORD)",
+		},
+		{
+			name:  "unterminated expansion",
+			value: "--password=$(DB_PASSWORD",
+			want:  "--password=$(DB_PASSWORD",
+		},
+		{
+			name:      "mixed expansions",
+			value:     "$(DB_USER):$(DB_PASSWORD)$",
+			want:      "$(DB_USER):$$(DB_PASSWORD)$",
+			wantFound: []string{"DB_PASSWORD"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, found := scanExpansions(tt.value, names, true)
+			if got != tt.want || !reflect.DeepEqual(found, tt.wantFound) {
+				t.Errorf("scanExpansions() = %q, %v, want %q, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_handleSecretExpansions(t *testing.T) {
+	envVars := []secretEnvVar{*makeTestSecretEnvVar("DB_PASSWORD", inlineEnvSource)}
+	tests := []struct {
+		name         string
+		policy       string
+		container    corev1.Container
+		wantArgs     []string
+		wantWarnings int
+		wantErr      bool
+		wantCommand  []string
+	}{
+		{
+			name:        "no expansion",
+			container:   corev1.Container{Command: []string{"psql"}},
+			wantCommand: []string{"psql"},
+		},
+		{
+			name:        "rewrite",
+			container:   corev1.Container{Command: []string{"psql", "--password=$(DB_PASSWORD)"}},
+			wantArgs:    []string{"--expand-args=DB_PASSWORD"},
+			wantCommand: []string{"psql", "--password=$$(DB_PASSWORD)"},
+		},
+		{
+			name:         "warn",
+			policy:       policyWarn,
+			container:    corev1.Container{Command: []string{"psql", "--password=$(DB_PASSWORD)"}},
+			wantWarnings: 1,
+			wantCommand:  []string{"psql", "--password=$(DB_PASSWORD)"},
+		},
+		{
+			name:      "deny",
+			policy:    policyDeny,
+			container: corev1.Container{Command: []string{"psql", "--password=$(DB_PASSWORD)"}},
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{secretExpansion: tt.policy}
+			c := tt.container
+			args, warnings, err := mw.handleSecretExpansions(&c, envVars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mutatingWebhook.handleSecretExpansions() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) || len(warnings) != tt.wantWarnings {
+				t.Errorf("mutatingWebhook.handleSecretExpansions() = %v, %v, want %v, %d warnings", args, warnings, tt.wantArgs, tt.wantWarnings)
+			}
+			if !reflect.DeepEqual(c.Command, tt.wantCommand) {
+				t.Errorf("container command = %v, want %v", c.Command, tt.wantCommand)
+			}
+		})
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+)
+
+// helperTemplateConfigMapKey is the ConfigMap key holding helper template document
+const helperTemplateConfigMapKey = "template.yaml"
+
+// helperContainerFields copy-secrets-init init container fields helper template can set; other fields either are
+// secrets-init settings (name marks mutated pods, image and arguments copy secrets-init binary) or change what
+// the init container runs and can access
+var helperContainerFields = []string{"resources", "securityContext", "env", "imagePullPolicy"}
+
+// ErrInvalidHelperTemplate helper template cannot be loaded
+var ErrInvalidHelperTemplate = errors.New("invalid helper template")
+
+// helperTemplate operator provided settings of secrets-init init container and volume
+//
+//	container:          # merged into copy-secrets-init init container (strategic merge); only helperContainerFields
+//	  resources:
+//	    limits:
+//	      memory: 64Mi
+//	  securityContext:
+//	    runAsNonRoot: true
+//	    allowPrivilegeEscalation: false
+//	  env:
+//	    - name: TZ
+//	      value: UTC
+//	emptyDir:           # replaces emptyDir of secrets-init volume
+//	  medium: Memory
+//	  sizeLimit: 16Mi
+type helperTemplate struct {
+	// container strategic merge patch of copy-secrets-init init container
+	container []byte
+	// emptyDir secrets-init volume source; default in-memory emptyDir if nil
+	emptyDir *corev1.EmptyDirVolumeSource
+}
+
+// parseHelperTemplate parses and validates helper template document
+func parseHelperTemplate(data []byte) (*helperTemplate, error) {
+	var doc struct {
+		Container json.RawMessage              `json:"container,omitempty"`
+		EmptyDir  *corev1.EmptyDirVolumeSource `json:"emptyDir,omitempty"`
+	}
+	if err := yaml.UnmarshalStrict(data, &doc); err != nil {
+		return nil, errors.Wrap(ErrInvalidHelperTemplate, err.Error())
+	}
+	template := &helperTemplate{emptyDir: doc.EmptyDir}
+	if len(doc.Container) == 0 {
+		return template, nil
+	}
+
+	var container corev1.Container
+	decoder := json.NewDecoder(bytes.NewReader(doc.Container))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&container); err != nil {
+		return nil, errors.Wrapf(ErrInvalidHelperTemplate, "container: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(doc.Container, &fields); err != nil {
+		return nil, errors.Wrapf(ErrInvalidHelperTemplate, "container: %v", err)
+	}
+	for field := range fields {
+		if !contains(helperContainerFields, field) {
+			return nil, errors.Wrapf(ErrInvalidHelperTemplate, "container: %s cannot be set, only %s",
+				field, strings.Join(helperContainerFields, ", "))
+		}
+	}
+	template.container = doc.Container
+	// fail early: template must merge into generated init container
+	if _, err := template.apply(getSecretsInitContainer(secretsInitImage, "", binVolumeName, binVolumePath, linuxOS)); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// loadHelperTemplate loads helper template from file or <namespace>/<name> ConfigMap; nil if neither is set
+func loadHelperTemplate(ctx context.Context, client kubernetes.Interface, file, configMap string) (*helperTemplate, error) {
+	var data []byte
+	switch {
+	case file != "" && configMap != "":
+		return nil, errors.Wrap(ErrInvalidHelperTemplate, "either template file or ConfigMap can be set")
+	case file != "":
+		raw, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read helper template file %s", file)
+		}
+		data = raw
+	case configMap != "":
+		ns, name, ok := strings.Cut(configMap, "/")
+		if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+			return nil, errors.Wrapf(ErrInvalidHelperTemplate, "configmap %q: expected <namespace>/<name>", configMap)
+		}
+		cm, err := client.CoreV1().ConfigMaps(ns).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get helper template configmap %s", configMap)
+		}
+		data = []byte(cm.Data[helperTemplateConfigMapKey])
+	default:
+		return nil, nil
+	}
+	return parseHelperTemplate(data)
+}
+
+// apply merges template into secrets-init init container
+func (t *helperTemplate) apply(container corev1.Container) (corev1.Container, error) {
+	if t == nil || len(t.container) == 0 {
+		return container, nil
+	}
+	original, err := json.Marshal(container)
+	if err != nil {
+		return container, errors.Wrap(err, "failed to encode secrets-init container")
+	}
+	merged, err := strategicpatch.StrategicMergePatch(original, t.container, corev1.Container{})
+	if err != nil {
+		return container, errors.Wrapf(ErrInvalidHelperTemplate, "container: %v", err)
+	}
+	var result corev1.Container
+	if err = json.Unmarshal(merged, &result); err != nil {
+		return container, errors.Wrap(err, "failed to decode secrets-init container")
+	}
+	return result, nil
+}
+
+// volume returns secrets-init volume with template emptyDir settings
+func (t *helperTemplate) volume(volumeName string) corev1.Volume {
+	volume := getSecretsInitVolume(volumeName)
+	if t != nil && t.emptyDir != nil {
+		volume.EmptyDir = t.emptyDir.DeepCopy()
+	}
+	return volume
+}
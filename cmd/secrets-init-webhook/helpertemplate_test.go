@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testHelperTemplate = `
+container:
+  resources:
+    limits:
+      memory: 64Mi
+  securityContext:
+    runAsNonRoot: true
+    allowPrivilegeEscalation: false
+  env:
+    - name: TZ
+      value: UTC
+emptyDir:
+  sizeLimit: 16Mi
+`
+
+func Test_parseHelperTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		wantErr  bool
+	}{
+		{
+			name:     "container and emptyDir",
+			template: testHelperTemplate,
+		},
+		{
+			name:     "empty template",
+			template: "",
+		},
+		{
+			name:     "unknown field",
+			template: "container:\n  resource: {}\n",
+			wantErr:  true,
+		},
+		{
+			name:     "container name",
+			template: "container:\n  name: copy\n",
+			wantErr:  true,
+		},
+		{
+			name:     "container args",
+			template: "container:\n  args: [copy, /tmp]\n",
+			wantErr:  true,
+		},
+		{
+			name:     "container volume mounts",
+			template: "container:\n  volumeMounts:\n    - name: host\n      mountPath: /host\n",
+			wantErr:  true,
+		},
+		{
+			name:     "container working dir",
+			template: "container:\n  workingDir: /tmp\n",
+			wantErr:  true,
+		},
+		{
+			name:     "container image pull policy",
+			template: "container:\n  imagePullPolicy: Always\n",
+		},
+		{
+			name:     "invalid size limit",
+			template: "emptyDir:\n  sizeLimit: 16 megabytes\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseHelperTemplate([]byte(tt.template))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseHelperTemplate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_injectSecretsInit_template(t *testing.T) {
+	template, err := parseHelperTemplate([]byte(testHelperTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mw := &mutatingWebhook{
+		k8sClient:      fake.NewSimpleClientset(),
+		registry:       &MockRegistry{Image: v1.Config{}},
+		provider:       "aws",
+		image:          secretsInitImage,
+		volumeName:     binVolumeName,
+		volumePath:     binVolumePath,
+		helperTemplate: template,
+	}
+	pod := makeTestPod()
+	if _, err = mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+	}
+
+	copyContainer := pod.Spec.InitContainers[0]
+	if copyContainer.Name != secretsInitContainerName || !reflect.DeepEqual(copyContainer.Args, []string{"copy", binVolumePath}) {
+		t.Errorf("secrets-init container = %+v, want generated name and args", copyContainer)
+	}
+	wantResources := corev1.ResourceRequirements{
+		Requests: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(requestsCPU),
+			corev1.ResourceMemory: resource.MustParse(requestsMemory),
+		},
+		Limits: corev1.ResourceList{
+			corev1.ResourceCPU:    resource.MustParse(limitsCPU),
+			corev1.ResourceMemory: resource.MustParse("64Mi"),
+		},
+	}
+	if !reflect.DeepEqual(copyContainer.Resources, wantResources) {
+		t.Errorf("secrets-init container resources = %v, want %v", copyContainer.Resources, wantResources)
+	}
+	if sc := copyContainer.SecurityContext; sc == nil || sc.RunAsNonRoot == nil || !*sc.RunAsNonRoot ||
+		sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+		t.Errorf("secrets-init container securityContext = %+v", sc)
+	}
+	if !reflect.DeepEqual(copyContainer.Env, []corev1.EnvVar{{Name: "TZ", Value: "UTC"}}) {
+		t.Errorf("secrets-init container env = %v", copyContainer.Env)
+	}
+
+	sizeLimit := resource.MustParse("16Mi")
+	wantVolume := corev1.Volume{Name: binVolumeName, VolumeSource: corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{SizeLimit: &sizeLimit}}}
+	if !reflect.DeepEqual(pod.Spec.Volumes, []corev1.Volume{wantVolume}) {
+		t.Errorf("pod volumes = %v, want %v", pod.Spec.Volumes, wantVolume)
+	}
+}
+
+func Test_loadHelperTemplate(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "template.yaml")
+	if err := os.WriteFile(file, []byte(testHelperTemplate), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	client := fake.NewSimpleClientset(&corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "helper-template", Namespace: "default"},
+		Data:       map[string]string{helperTemplateConfigMapKey: testHelperTemplate},
+	})
+	tests := []struct {
+		name      string
+		file      string
+		configMap string
+		wantNil   bool
+		wantErr   bool
+	}{
+		{name: "no template", wantNil: true},
+		{name: "file", file: file},
+		{name: "configmap", configMap: "default/helper-template"},
+		{name: "missing configmap", configMap: "default/missing", wantErr: true},
+		{name: "invalid configmap reference", configMap: "helper-template", wantErr: true},
+		{name: "file and configmap", file: file, configMap: "default/helper-template", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := loadHelperTemplate(context.TODO(), client, tt.file, tt.configMap)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("loadHelperTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && (got == nil) != tt.wantNil {
+				t.Errorf("loadHelperTemplate() = %v, wantNil %v", got, tt.wantNil)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/version"
+	"k8s.io/client-go/discovery"
+)
+
+const (
+	// injectionCopy secrets-init binary is copied by copy-secrets-init init container into emptyDir volume
+	injectionCopy = "copy"
+	// injectionImageVolume secrets-init image is mounted read-only as image volume
+	injectionImageVolume = "image-volume"
+
+	// imageVolumeMinVersion first Kubernetes version supporting image volumes with subPath mounts
+	imageVolumeMinVersion = "1.33.0"
+)
+
+// ErrInvalidInjectionMode unknown injection mode
+var ErrInvalidInjectionMode = errors.New("invalid injection mode")
+
+func isInjectionMode(mode string) bool {
+	return mode == injectionCopy || mode == injectionImageVolume || mode == injectionPreinstalled
+}
+
+// parseInjectionModeNamespaces parses <namespace>=<mode> values into per namespace injection modes
+func parseInjectionModeNamespaces(values []string) (map[string]string, error) {
+	modes := map[string]string{}
+	for _, value := range values {
+		ns, mode, ok := strings.Cut(value, "=")
+		if !ok || ns == "" || !isInjectionMode(mode) {
+			return nil, errors.Wrapf(ErrInvalidInjectionMode, "expected <namespace>=copy|image-volume|preinstalled, got %q", value)
+		}
+		modes[ns] = mode
+	}
+	return modes, nil
+}
+
+// imageVolumeSupported checks image volumes can be used: the ImageVolume feature gate cannot be detected
+// (API server silently drops image volume source if it is disabled), so the operator must assert it is enabled
+// on API server and kubelets; API server version must support image volumes with subPath mounts
+func imageVolumeSupported(client discovery.ServerVersionInterface, featureGate bool) (bool, error) {
+	if !featureGate {
+		logger.Warn("image volumes require ImageVolume feature gate asserted with image-volume-feature-gate flag, fall back to copy injection mode")
+		return false, nil
+	}
+	info, err := client.ServerVersion()
+	if err != nil {
+		return false, errors.Wrap(err, "failed to get API server version")
+	}
+	serverVersion, err := version.ParseGeneric(info.GitVersion)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to parse API server version %q", info.GitVersion)
+	}
+	if !serverVersion.AtLeast(version.MustParseGeneric(imageVolumeMinVersion)) {
+		logger.Warnf("image volumes require Kubernetes %s or newer, fall back to copy injection mode", imageVolumeMinVersion)
+		return false, nil
+	}
+	return true, nil
+}
+
+// podInjectionMode returns injection mode for the pod: pod mutated before (or with its own hostPath or CSI
+// secrets-init volume) keeps its mode, otherwise namespace or server mode is used, falling back to copy if
+// image volumes are not supported
+func (mw *mutatingWebhook) podInjectionMode(pod *corev1.Pod, ns string) string {
+	volume := podVolume(pod, mw.volumeName)
+	switch {
+	case hasContainer(pod.Spec.InitContainers, secretsInitContainerName):
+		return injectionCopy
+	case volume == nil:
+	case volume.Image != nil:
+		return injectionImageVolume
+	case volume.HostPath != nil || volume.CSI != nil:
+		return injectionPreinstalled
+	default:
+		return injectionCopy
+	}
+	mode := mw.injectionMode
+	if nsMode, ok := mw.injectionModeNamespaces[ns]; ok {
+		mode = nsMode
+	}
+	if mode != injectionImageVolume {
+		return mode
+	}
+	if !mw.imageVolumesSupported {
+		logger.WithField("pod", pod.Name).Debug("image volumes are not supported, fall back to copy injection mode")
+		return injectionCopy
+	}
+	return injectionImageVolume
+}
+
+// secretsInitVolumeMount returns mount of secrets-init volume for wrapped containers; ephemeral containers mount
+// the whole image volume, since API server rejects subPath mounts of ephemeral containers
+func (mw *mutatingWebhook) secretsInitVolumeMount() corev1.VolumeMount {
+	mount := corev1.VolumeMount{Name: mw.volumeName, MountPath: mw.volumePath}
+	switch mw.injectionMode {
+	case injectionImageVolume:
+		mount.ReadOnly = true
+		if !mw.ephemeral {
+			mount.SubPath = mw.imageVolumeSubPath
+		}
+	case injectionPreinstalled:
+		mount.ReadOnly = true
+	}
+	return mount
+}
+
+// secretsInitCommand returns secrets-init binary path for wrapped containers
+func (mw *mutatingWebhook) secretsInitCommand() string {
+	if mw.injectionMode == injectionImageVolume && mw.ephemeral {
+		return path.Join(mw.volumePath, mw.imageVolumeSubPath, mw.secretsInitBinary())
+	}
+	return fmt.Sprintf("%s/%s", mw.volumePath, mw.secretsInitBinary())
+}
+
+// injected checks pod has secrets-init binary volume (and copy-secrets-init init container in copy mode);
+// preinstalled volume must be allowed
+func (mw *mutatingWebhook) injected(pod *corev1.Pod) bool {
+	volume := podVolume(pod, mw.volumeName)
+	switch mw.injectionMode {
+	case injectionImageVolume:
+		return volume != nil && volume.Image != nil
+	case injectionPreinstalled:
+		return volume != nil && preinstalledVolumeAllowed(&volume.VolumeSource, mw.preinstalledVolumeAllowlist)
+	}
+	return hasContainer(pod.Spec.InitContainers, secretsInitContainerName) && hasVolume(pod.Spec.Volumes, mw.volumeName)
+}
+
+// injectImageVolume adds secrets-init image volume, unless pod already has it after earlier mutation
+func (mw *mutatingWebhook) injectImageVolume(pod *corev1.Pod) {
+	if hasVolume(pod.Spec.Volumes, mw.volumeName) {
+		logger.WithField("pod", pod.Name).Debug("pod already has secrets-init image volume")
+		return
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+		Name: mw.volumeName,
+		VolumeSource: corev1.VolumeSource{
+			Image: &corev1.ImageVolumeSource{Reference: mw.image, PullPolicy: corev1.PullPolicy(mw.pullPolicy)},
+		},
+	})
+	logger.Debug("successfully appended pod spec image volume")
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"k8s.io/apimachinery/pkg/version"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const imageVolumeTestPod = `{
+  "apiVersion": "v1",
+  "kind": "Pod",
+  "metadata": {"name": "test-pod", "namespace": "test-ns"},
+  "spec": {
+    "containers": [
+      {"name": "app", "image": "app", "command": ["app"], "env": [{"name": "PASSWORD", "value": "` + testSecretARN + `"}]}
+    ]
+  }
+}`
+
+type imageVolumeTestPodSpec struct {
+	InitContainers []struct {
+		Name string `json:"name"`
+	} `json:"initContainers"`
+	Containers []struct {
+		Name         string `json:"name"`
+		VolumeMounts []struct {
+			Name      string `json:"name"`
+			MountPath string `json:"mountPath"`
+			ReadOnly  bool   `json:"readOnly"`
+			SubPath   string `json:"subPath"`
+		} `json:"volumeMounts"`
+	} `json:"containers"`
+	Volumes []map[string]interface{} `json:"volumes"`
+}
+
+// helper function - decode pod spec of pod JSON
+func decodeImageVolumeTestPod(t *testing.T, raw []byte) imageVolumeTestPodSpec {
+	t.Helper()
+	var pod struct {
+		Spec imageVolumeTestPodSpec `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		t.Fatal(err)
+	}
+	return pod.Spec
+}
+
+func Test_mutatingWebhook_secretsMutator_imageVolume(t *testing.T) {
+	imageVolume := map[string]interface{}{
+		"name":  binVolumeName,
+		"image": map[string]interface{}{"reference": secretsInitImage, "pullPolicy": "IfNotPresent"},
+	}
+	tests := []struct {
+		name           string
+		mode           string
+		namespaceModes map[string]string
+		supported      bool
+		wantImage      bool
+	}{
+		{
+			name:      "server image-volume mode",
+			mode:      injectionImageVolume,
+			supported: true,
+			wantImage: true,
+		},
+		{
+			name:           "namespace image-volume mode",
+			mode:           injectionCopy,
+			namespaceModes: map[string]string{"test-ns": injectionImageVolume},
+			supported:      true,
+			wantImage:      true,
+		},
+		{
+			name:           "namespace copy mode",
+			mode:           injectionImageVolume,
+			namespaceModes: map[string]string{"test-ns": injectionCopy},
+			supported:      true,
+		},
+		{
+			name: "fall back to copy mode if image volumes are not supported",
+			mode: injectionImageVolume,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:               fake.NewSimpleClientset(),
+				registry:                &MockRegistry{Image: v1.Config{}},
+				provider:                "aws",
+				image:                   secretsInitImage,
+				pullPolicy:              "IfNotPresent",
+				volumeName:              binVolumeName,
+				volumePath:              binVolumePath,
+				injectionMode:           tt.mode,
+				injectionModeNamespaces: tt.namespaceModes,
+				imageVolumesSupported:   tt.supported,
+				imageVolumeSubPath:      "usr/local/bin",
+			}
+			patched := reviewPod(t, mw, []byte(imageVolumeTestPod))
+			// mutation is idempotent: reinvoked webhook keeps injection mode
+			reinvoked := reviewPod(t, mw, patched)
+			if !reflect.DeepEqual(decodeImageVolumeTestPod(t, reinvoked), decodeImageVolumeTestPod(t, patched)) {
+				t.Errorf("reinvoked pod = %s, want %s", reinvoked, patched)
+			}
+
+			spec := decodeImageVolumeTestPod(t, patched)
+			if len(spec.Volumes) != 1 {
+				t.Fatalf("volumes = %v, want one secrets-init volume", spec.Volumes)
+			}
+			mounts := spec.Containers[0].VolumeMounts
+			if len(mounts) != 1 || mounts[0].Name != binVolumeName || mounts[0].MountPath != binVolumePath {
+				t.Fatalf("volume mounts = %+v, want secrets-init volume mount", mounts)
+			}
+			if !tt.wantImage {
+				if len(spec.InitContainers) != 1 || spec.InitContainers[0].Name != secretsInitContainerName {
+					t.Errorf("init containers = %+v, want %s", spec.InitContainers, secretsInitContainerName)
+				}
+				if spec.Volumes[0]["emptyDir"] == nil {
+					t.Errorf("volume = %v, want emptyDir", spec.Volumes[0])
+				}
+				return
+			}
+			if len(spec.InitContainers) != 0 {
+				t.Errorf("init containers = %+v, want none", spec.InitContainers)
+			}
+			if !reflect.DeepEqual(spec.Volumes[0], imageVolume) {
+				t.Errorf("volume = %v, want %v", spec.Volumes[0], imageVolume)
+			}
+			if !mounts[0].ReadOnly || mounts[0].SubPath != "usr/local/bin" {
+				t.Errorf("volume mount = %+v, want read-only with subPath usr/local/bin", mounts[0])
+			}
+		})
+	}
+}
+
+func Test_parseInjectionModeNamespaces(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "no values",
+			values: nil,
+			want:   map[string]string{},
+		},
+		{
+			name:   "namespace modes",
+			values: []string{"team-a=image-volume", "team-b=copy"},
+			want:   map[string]string{"team-a": injectionImageVolume, "team-b": injectionCopy},
+		},
+		{
+			name:    "unknown mode",
+			values:  []string{"team-a=hostpath"},
+			wantErr: true,
+		},
+		{
+			name:    "missing namespace",
+			values:  []string{"=copy"},
+			wantErr: true,
+		},
+		{
+			name:    "missing mode",
+			values:  []string{"team-a"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseInjectionModeNamespaces(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseInjectionModeNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseInjectionModeNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_imageVolumeSupported(t *testing.T) {
+	tests := []struct {
+		name        string
+		gitVersion  string
+		featureGate bool
+		want        bool
+		wantErr     bool
+	}{
+		{name: "supported", gitVersion: "v1.33.1", featureGate: true, want: true},
+		{name: "managed cluster version", gitVersion: "v1.34.0-eks-4096722", featureGate: true, want: true},
+		{name: "feature gate not asserted", gitVersion: "v1.34.0", want: false},
+		{name: "not supported", gitVersion: "v1.31.4-gke.1000", featureGate: true, want: false},
+		{name: "invalid version", gitVersion: "unknown", featureGate: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := fake.NewSimpleClientset().Discovery().(*fakediscovery.FakeDiscovery)
+			client.FakedServerVersion = &version.Info{GitVersion: tt.gitVersion}
+			got, err := imageVolumeSupported(client, tt.featureGate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("imageVolumeSupported() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("imageVolumeSupported() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
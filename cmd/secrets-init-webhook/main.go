@@ -7,9 +7,12 @@ import (
 	"os"
 	"runtime"
 	"strings"
+	"time"
 
 	"github.com/Masterminds/semver/v3"
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
 	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/registry"
+	"github.com/google/go-containerregistry/pkg/name"
 	"github.com/pkg/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -21,11 +24,14 @@ import (
 	wh "github.com/slok/kubewebhook/v2/pkg/webhook"
 	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
 	"github.com/urfave/cli"
+	authenticationv1 "k8s.io/api/authentication/v1"
 	corev1 "k8s.io/api/core/v1"
-	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/cache"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	kubernetesConfig "sigs.k8s.io/controller-runtime/pkg/client/config"
 )
 
@@ -61,8 +67,30 @@ var (
 	Platform = ""
 	// ErrNoValue no value error
 	ErrNoValue = errors.New("no value")
+	// ErrMixedProviders container references secrets from more than one provider
+	ErrMixedProviders = errors.New("secret references from multiple providers")
+	// ErrInvalidPolicyAction unknown policy action
+	ErrInvalidPolicyAction = errors.New("invalid policy action")
 )
 
+// policy actions for pods that cannot be mutated safely
+const (
+	policyDeny = "deny"
+	policyWarn = "warn"
+)
+
+func isPolicyAction(action string, allowed ...string) bool {
+	for _, a := range allowed {
+		if action == a {
+			return true
+		}
+	}
+	return false
+}
+
+// inlineEnvSource is the source of env var defined with value in container spec
+const inlineEnvSource = "inline env"
+
 type mutatingWebhook struct {
 	k8sClient  kubernetes.Interface
 	registry   registry.ImageRegistry
@@ -71,21 +99,88 @@ type mutatingWebhook struct {
 	pullPolicy string
 	volumeName string
 	volumePath string
+	// invalidReferences policy for malformed secret references: deny (default) or warn
+	invalidReferences string
+	// policyConfigMap <namespace>/<name> of ConfigMap with reference policy; no policy if empty
+	policyConfigMap string
+	// secretExpansion policy for $(VAR) expansion of secret reference variables: rewrite (default), deny or warn
+	secretExpansion string
+	// objects ConfigMap and Secret informer cache; all lookups go to API server if nil
+	objects *objectCache
+	// secretAccess whether Secrets are read: read (default) or none
+	secretAccess string
+	// secretAccessNamespaces per namespace secret access overrides
+	secretAccessNamespaces map[string]string
+	// objectAccess whose permissions are used to read ConfigMaps and Secrets: webhook (default), impersonate or subject-access-review
+	objectAccess string
+	// impersonate creates client impersonating admission request user
+	impersonate func(user *authenticationv1.UserInfo) (kubernetes.Interface, error)
+	// overrideAllowlist allowed patterns of settings overridden with pod annotations, keyed by setting name
+	overrideAllowlist map[string][]string
+	// nonLinuxPods policy for pods targeting OS without secrets-init image: skip (default) or deny
+	nonLinuxPods string
+	// osImages secrets-init images for non-Linux OS, keyed by OS
+	osImages map[string]string
+	// os OS of secrets-init image: linux if empty
+	os string
+	// helperTemplate operator settings of secrets-init init container and volume; defaults if nil
+	helperTemplate *helperTemplate
+	// injectionMode how secrets-init binary is provided: copy (default) or image-volume
+	injectionMode string
+	// injectionModeNamespaces per namespace injection mode overrides
+	injectionModeNamespaces map[string]string
+	// imageVolumesSupported whether API server supports image volumes
+	imageVolumesSupported bool
+	// imageVolumeSubPath directory with secrets-init binary in secrets-init image
+	imageVolumeSubPath string
+	// preinstalledVolume hostPath or CSI volume source with secrets-init binary pre-installed on nodes
+	preinstalledVolume *corev1.VolumeSource
+	// preinstalledVolumeAllowlist allowed hostPath and CSI secrets-init volume sources
+	preinstalledVolumeAllowlist []preinstalledVolumeRule
+	// ephemeral wraps ephemeral containers, which cannot have subPath volume mounts
+	ephemeral bool
+	// policyConfigs reference policy document parsed from policy ConfigMap; parsed on every use if nil
+	policyConfigs *policyConfigCache
+	// namespaceLevels Pod Security Standards levels of namespaces, cached for namespaceLevelTTL; not cached if nil
+	namespaceLevels *cache.LRUExpireCache
+}
+
+// secretEnvVar environment variable that references a secret in a secrets manager
+type secretEnvVar struct {
+	corev1.EnvVar
+	// Reference secret reference for value that is a reference as a whole; nil for templated value
+	Reference *reference.SecretReference
+	// Template secret references embedded in templated value with ${<reference>} placeholders
+	Template []*reference.SecretReference
+	// Source where env var value comes from: inline env, ConfigMap key or Secret key
+	Source string
+	// Err reference parse error for malformed reference
+	Err error
+	// Hidden env var from Secret the webhook does not read; value is unknown
+	Hidden bool
+}
+
+// references returns all secret references of the env var
+func (e *secretEnvVar) references() []*reference.SecretReference {
+	if e.Reference != nil {
+		return []*reference.SecretReference{e.Reference}
+	}
+	return e.Template
 }
 
 var logger *log.Logger
 
-func newK8SClient() (kubernetes.Interface, error) {
+func newK8SClient() (kubernetes.Interface, *rest.Config, error) {
 	kubeConfig, err := kubernetesConfig.GetConfig()
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to get kubernetes config")
+		return nil, nil, errors.Wrap(err, "failed to get kubernetes config")
 	}
 
 	client, err := kubernetes.NewForConfig(kubeConfig)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create kubernetes client")
+		return nil, nil, errors.Wrap(err, "failed to create kubernetes client")
 	}
-	return client, nil
+	return client, kubeConfig, nil
 }
 
 func healthzHandler(w http.ResponseWriter, _ *http.Request) {
@@ -123,142 +218,204 @@ func handlerFor(config mutating.WebhookConfig, recorder wh.MetricsRecorder, logg
 	return handler
 }
 
-// check if value start with AWS or GCP secret prefix
-func hasSecretsPrefix(value string) bool {
-	return strings.HasPrefix(value, "gcp:secretmanager:") ||
-		strings.HasPrefix(value, "arn:aws:secretsmanager") ||
-		(strings.HasPrefix(value, "arn:aws:ssm") && strings.Contains(value, ":parameter/"))
-}
-
-func (mw *mutatingWebhook) getDataFromConfigmap(ctx context.Context, cmName, ns string) (map[string]string, error) {
-	configMap, err := mw.k8sClient.CoreV1().ConfigMaps(ns).Get(ctx, cmName, metav1.GetOptions{})
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, cmName)
+// lookupSecretEnvVar returns secret env var if value references a known secrets manager, nil otherwise
+func lookupSecretEnvVar(name, value, source string) *secretEnvVar {
+	ref, err := reference.Lookup(value)
+	if errors.Is(err, reference.ErrNoMatch) {
+		template, templateErr := reference.LookupTemplate(value)
+		if errors.Is(templateErr, reference.ErrNoMatch) {
+			return nil
+		}
+		return &secretEnvVar{
+			EnvVar:   corev1.EnvVar{Name: name, Value: value},
+			Template: template,
+			Source:   source,
+			Err:      templateErr,
+		}
+	}
+	return &secretEnvVar{
+		EnvVar:    corev1.EnvVar{Name: name, Value: value},
+		Reference: ref,
+		Source:    source,
+		Err:       err,
 	}
-	return configMap.Data, nil
 }
 
-func (mw *mutatingWebhook) getDataFromSecret(ctx context.Context, secretName, ns string) (map[string][]byte, error) {
-	secret, err := mw.k8sClient.CoreV1().Secrets(ns).Get(ctx, secretName, metav1.GetOptions{})
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get secret %s/%s", ns, secretName)
-	}
-	return secret.Data, nil
+func configMapKeySource(ns, name, key string) string {
+	return fmt.Sprintf("configmap %s/%s key %s", ns, name, key)
 }
 
-//nolint:gocognit, gocyclo
-func (mw *mutatingWebhook) lookForEnvFrom(envFrom []corev1.EnvFromSource, ns string) ([]corev1.EnvVar, error) {
-	var envVars []corev1.EnvVar
+func secretKeySource(ns, name, key string) string {
+	return fmt.Sprintf("secret %s/%s key %s", ns, name, key)
+}
 
-	for _, ef := range envFrom {
-		if ef.ConfigMapRef != nil {
-			data, err := mw.getDataFromConfigmap(context.TODO(), ef.ConfigMapRef.Name, ns)
-			if err != nil {
-				if apierrors.IsNotFound(err) && ef.ConfigMapRef.Optional != nil && *ef.ConfigMapRef.Optional {
-					continue
-				}
-				return envVars, errors.Wrapf(err, "failed to get configmap %s/%s", ns, ef.ConfigMapRef.Name)
+// selectProvider returns secrets-init provider for references found in a container;
+// falls back to the webhook default provider if none can be derived from references
+func (mw *mutatingWebhook) selectProvider(envVars []secretEnvVar) (string, error) {
+	var providers []string
+	for _, env := range envVars {
+		for _, ref := range env.references() {
+			p := string(ref.Provider)
+			if p == "" {
+				continue
 			}
-			for key, value := range data {
-				if hasSecretsPrefix(value) {
-					envFromCM := corev1.EnvVar{
-						Name:  key,
-						Value: value,
-					}
-					envVars = append(envVars, envFromCM)
-				}
-			}
-		}
-		if ef.SecretRef != nil {
-			data, err := mw.getDataFromSecret(context.TODO(), ef.SecretRef.Name, ns)
-			if err != nil {
-				if apierrors.IsNotFound(err) && ef.SecretRef.Optional != nil && *ef.SecretRef.Optional {
-					continue
-				}
-				return envVars, errors.Wrapf(err, "failed to get secret %s/%s", ns, ef.SecretRef.Name)
+			found := false
+			for _, existing := range providers {
+				found = found || existing == p
 			}
-			for key, value := range data {
-				if hasSecretsPrefix(string(value)) {
-					envFromSec := corev1.EnvVar{
-						Name:  key,
-						Value: string(value),
-					}
-					envVars = append(envVars, envFromSec)
-				}
+			if !found {
+				providers = append(providers, p)
 			}
 		}
 	}
-	return envVars, nil
+	switch len(providers) {
+	case 0:
+		return mw.provider, nil
+	case 1:
+		return providers[0], nil
+	default:
+		return "", errors.Wrapf(ErrMixedProviders, "[%s]", strings.Join(providers, ", "))
+	}
 }
 
-func (mw *mutatingWebhook) lookForValueFrom(env corev1.EnvVar, ns string) (*corev1.EnvVar, error) {
-	if env.ValueFrom.ConfigMapKeyRef != nil {
-		data, err := mw.getDataFromConfigmap(context.TODO(), env.ValueFrom.ConfigMapKeyRef.Name, ns)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, env.ValueFrom.ConfigMapKeyRef.Name)
-		}
-		if hasSecretsPrefix(data[env.ValueFrom.ConfigMapKeyRef.Key]) {
-			fromCM := corev1.EnvVar{
-				Name:  env.Name,
-				Value: data[env.ValueFrom.ConfigMapKeyRef.Key],
-			}
-			return &fromCM, nil
+// templateArgs returns secrets-init arguments listing env vars that need template rendering
+func templateArgs(envVars []secretEnvVar) []string {
+	var names []string
+	for _, env := range envVars {
+		if env.Template != nil && !contains(names, env.Name) {
+			names = append(names, env.Name)
 		}
 	}
-	if env.ValueFrom.SecretKeyRef != nil {
-		data, err := mw.getDataFromSecret(context.TODO(), env.ValueFrom.SecretKeyRef.Name, ns)
-		if err != nil {
-			return nil, errors.Wrapf(err, "failed to get secret %s/%s", ns, env.ValueFrom.SecretKeyRef.Name)
+	if len(names) == 0 {
+		return nil
+	}
+	return []string{fmt.Sprintf("--template-env=%s", strings.Join(names, ","))}
+}
+
+// checkReferences denies or warns (depending on webhook configuration) about malformed secret references
+func (mw *mutatingWebhook) checkReferences(containerName string, envVars []secretEnvVar) ([]string, error) {
+	var warnings []string
+	for _, env := range envVars {
+		if env.Err == nil {
+			continue
 		}
-		if hasSecretsPrefix(string(data[env.ValueFrom.SecretKeyRef.Key])) {
-			fromSecret := corev1.EnvVar{
-				Name:  env.Name,
-				Value: string(data[env.ValueFrom.SecretKeyRef.Key]),
-			}
-			return &fromSecret, nil
+		err := errors.Wrapf(env.Err, "container %s: env %s (from %s)", containerName, env.Name, env.Source)
+		if mw.invalidReferences != policyWarn {
+			return nil, err
 		}
+		logger.WithError(err).Warn("malformed secret reference")
+		warnings = append(warnings, err.Error())
 	}
-	return nil, ErrNoValue
+	return warnings, nil
 }
 
-//nolint:gocognit
-func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSpec *corev1.PodSpec, ns string) (bool, error) {
+//nolint:gocognit,gocyclo,funlen
+func (mw *mutatingWebhook) mutateContainers(ctx context.Context, containers []corev1.Container, pod *corev1.Pod, ns string) (bool, []string, error) {
 	if len(containers) == 0 {
-		return false, nil
+		return false, nil, nil
 	}
 
 	var mutated bool
+	var warnings []string
+	var policy *referencePolicy
+	var policyLoaded bool
 	for i, container := range containers {
-		var envVars []corev1.EnvVar
-		if len(container.EnvFrom) > 0 {
-			envFrom, err := mw.lookForEnvFrom(container.EnvFrom, ns)
-			if err != nil {
-				return false, errors.Wrap(err, "failed to look for envFrom")
-			}
-			envVars = append(envVars, envFrom...)
+		selected, reason := selectContainer(pod, container.Name)
+		if reason != "" {
+			logger.WithFields(log.Fields{"pod": pod.Name, "container": container.Name, "selected": selected}).Info(reason)
+		}
+		if !selected {
+			continue
+		}
+		if isWrapped(&containers[i]) {
+			logger.WithFields(log.Fields{"pod": pod.Name, "container": container.Name}).Info("container is already mutated")
+			continue
 		}
 
-		for _, env := range container.Env {
-			if hasSecretsPrefix(env.Value) {
-				envVars = append(envVars, env)
-			}
-			if env.ValueFrom != nil {
-				valueFrom, err := mw.lookForValueFrom(env, ns)
-				if err != nil && !errors.Is(err, ErrNoValue) {
-					return false, errors.Wrap(err, "failed to look for valueFrom")
-				}
-				if valueFrom == nil {
-					continue
-				}
-				envVars = append(envVars, *valueFrom)
-			}
+		environment, err := mw.buildContainerEnv(ctx, container.EnvFrom, container.Env, ns)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "failed to look for environment of container %s", container.Name)
 		}
 
-		if len(envVars) == 0 {
+		envVars, hidden := splitHiddenEnvVars(environment.secretEnvVars())
+		if hidden && !injectRequested(pod) {
+			logger.WithField("container", container.Name).Debug("env from Secrets is not read, skip it without inject annotation")
+			hidden = false
+		}
+
+		if len(envVars) == 0 && !hidden {
 			// no environment variables referenced to GCP secret or AWS secret or SSM parameter
 			continue
 		}
 
+		for _, env := range envVars {
+			for _, ref := range env.references() {
+				logger.WithFields(log.Fields{
+					"container": container.Name,
+					"env":       env.Name,
+					"provider":  ref.Provider,
+					"reference": ref.String(),
+					"source":    env.Source,
+					"template":  env.Template != nil,
+				}).Debug("found secret reference")
+			}
+		}
+
+		refWarnings, err := mw.checkReferences(container.Name, envVars)
+		if err != nil {
+			return false, nil, err
+		}
+		warnings = append(warnings, refWarnings...)
+
+		// load policy only for pods that reference secrets
+		if !policyLoaded {
+			if policy, err = mw.namespacePolicy(ctx, ns); err != nil {
+				return false, nil, errors.Wrap(err, "failed to load reference policy")
+			}
+			policyLoaded = true
+		}
+		if err = checkPolicy(policy, container.Name, envVars); err != nil {
+			return false, nil, err
+		}
+		if hidden && policy.restricts() {
+			return false, nil, errors.Wrapf(ErrPolicyViolation, "container %s: env from Secrets the webhook does not read cannot be checked against namespace policy", container.Name)
+		}
+
+		provider, err := mw.selectProvider(envVars)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "container %s", container.Name)
+		}
+		providerArgs, err := mw.providerArgs(ctx, provider, pod, ns)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "container %s", container.Name)
+		}
+
+		expansionArgs, expansionWarnings, err := mw.handleSecretExpansions(&container, envVars)
+		if err != nil {
+			return false, nil, err
+		}
+		providerArgs = append(providerArgs, expansionArgs...)
+		providerArgs = append(providerArgs, templateArgs(envVars)...)
+		warnings = append(warnings, expansionWarnings...)
+		if err = checkGeneratedArgs(mw.image, providerArgs); err != nil {
+			return false, nil, errors.Wrapf(err, "container %s", container.Name)
+		}
+
+		optionArgs, optionEnv, err := mw.runtimeOptionArgs(pod)
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "container %s", container.Name)
+		}
+		providerArgs = append(providerArgs, optionArgs...)
+		setEnv(&container, optionEnv)
+
+		referenceEnv, err := mw.referenceEnv(provider, envVars, func(name string) bool {
+			return environment.defines(name) || hasEnv(container.Env, name)
+		})
+		if err != nil {
+			return false, nil, errors.Wrapf(err, "container %s", container.Name)
+		}
+		setEnv(&container, referenceEnv)
+
 		// set mutated flag
 		mutated = true
 
@@ -268,42 +425,79 @@ func (mw *mutatingWebhook) mutateContainers(containers []corev1.Container, podSp
 		// the container has no explicitly specified command
 		if len(args) == 0 {
 			c := container
-			imageConfig, err := mw.registry.GetImageConfig(context.Background(), mw.k8sClient, ns, &c, podSpec)
+			imageConfig, err := mw.registry.GetImageConfig(ctx, mw.k8sClient, ns, &c, mw.imagePodSpec(pod))
+			var platformErr *registry.PlatformError
+			if errors.As(err, &platformErr) {
+				return false, nil, &imageOSError{container: container.Name, os: mw.indexOS(platformErr.OSes)}
+			}
 			if err != nil {
-				return false, errors.Wrap(err, "failed to get image config")
+				return false, nil, errors.Wrap(err, "failed to get image config")
+			}
+			if imageConfig.OS != "" && imageConfig.OS != mw.targetOS() {
+				return false, nil, &imageOSError{container: container.Name, os: imageConfig.OS}
 			}
 
-			args = append(args, imageConfig.Entrypoint...)
+			args = append(args, imageConfig.Config.Entrypoint...)
 
 			// If no Args are defined we can use the Docker CMD from the image
 			// https://kubernetes.io/docs/tasks/inject-data-application/define-command-argument-container/#notes
 			if len(container.Args) == 0 {
-				args = append(args, imageConfig.Cmd...)
+				args = append(args, imageConfig.Config.Cmd...)
 			}
 		}
 
 		args = append(args, container.Args...)
 
-		container.Command = []string{fmt.Sprintf("%s/secrets-init", mw.volumePath)}
-		container.Args = append([]string{fmt.Sprintf("--provider=%s", mw.provider)}, args...)
+		container.Command = []string{mw.secretsInitCommand()}
+		container.Args = append(providerArgs, args...)
 
-		container.VolumeMounts = append(container.VolumeMounts, []corev1.VolumeMount{
-			{
-				Name:      mw.volumeName,
-				MountPath: mw.volumePath,
-			},
-		}...)
+		container.VolumeMounts = append(container.VolumeMounts, mw.secretsInitVolumeMount())
 
 		containers[i] = container
 	}
 
-	return mutated, nil
+	return mutated, warnings, nil
 }
 
-func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, ns string, dryRun bool) error {
-	initContainersMutated, err := mw.mutateContainers(pod.Spec.InitContainers, &pod.Spec, ns)
+// mutatePod mutates pod with secrets-init image for pod OS, or for container image OS if pod OS is not known
+func (mw *mutatingWebhook) mutatePod(ctx context.Context, pod *corev1.Pod, ns string, dryRun bool) ([]string, error) {
+	mw, err := mw.withPodOverrides(pod)
 	if err != nil {
-		return errors.Wrapf(err, "failed to mutate init containers for pod %s", pod.Name)
+		return nil, errors.Wrapf(err, "failed to apply annotations of pod %s", pod.Name)
+	}
+	mw.injectionMode = mw.podInjectionMode(pod, ns)
+
+	targetOS := podOS(pod)
+	osWebhook, err := mw.forOS(targetOS)
+	if err != nil {
+		return mw.skipNonLinux(pod, err)
+	}
+	// mutate pod copy: pod is left unchanged if container image OS turns out to be unsupported
+	mutated := pod.DeepCopy()
+	warnings, err := osWebhook.mutatePodSpec(ctx, mutated, ns, dryRun)
+	var imageErr *imageOSError
+	if errors.As(err, &imageErr) {
+		if targetOS != "" {
+			return mw.skipNonLinux(pod, err)
+		}
+		if osWebhook, err = mw.forOS(imageErr.os); err != nil {
+			return mw.skipNonLinux(pod, errors.Wrap(err, imageErr.Error()))
+		}
+		mutated = pod.DeepCopy()
+		warnings, err = osWebhook.mutatePodSpec(ctx, mutated, ns, dryRun)
+	}
+	if err != nil {
+		return nil, err
+	}
+	*pod = *mutated
+	return warnings, nil
+}
+
+// mutatePodSpec wraps pod containers with secrets-init and injects secrets-init init container and volume
+func (mw *mutatingWebhook) mutatePodSpec(ctx context.Context, pod *corev1.Pod, ns string, dryRun bool) ([]string, error) {
+	initContainersMutated, warnings, err := mw.mutateContainers(ctx, pod.Spec.InitContainers, pod, ns)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to mutate init containers for pod %s", pod.Name)
 	}
 
 	if initContainersMutated {
@@ -312,10 +506,11 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, ns string, dryRun bool) er
 		logger.Debug("no pod init containers were mutated")
 	}
 
-	containersMutated, err := mw.mutateContainers(pod.Spec.Containers, &pod.Spec, ns)
+	containersMutated, containerWarnings, err := mw.mutateContainers(ctx, pod.Spec.Containers, pod, ns)
 	if err != nil {
-		return errors.Wrapf(err, "failed to mutate containers for pod %s", pod.Name)
+		return nil, errors.Wrapf(err, "failed to mutate containers for pod %s", pod.Name)
 	}
+	warnings = append(warnings, containerWarnings...)
 
 	if containersMutated {
 		logger.Debug("successfully mutated pod containers")
@@ -323,18 +518,20 @@ func (mw *mutatingWebhook) mutatePod(pod *corev1.Pod, ns string, dryRun bool) er
 		logger.Debug("no pod containers were mutated")
 	}
 
-	if (initContainersMutated || containersMutated) && !dryRun {
-		// prepend secrets-init container (as the first init container)
-		pod.Spec.InitContainers = append(
-			[]corev1.Container{getSecretsInitContainer(mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath)},
-			pod.Spec.InitContainers...)
-		logger.Debug("successfully prepended pod init containers to spec")
-		// append volume
-		pod.Spec.Volumes = append(pod.Spec.Volumes, getSecretsInitVolume(mw.volumeName))
-		logger.Debug("successfully appended pod spec volumes")
+	// containers wrapped by earlier mutation need secrets-init too: repair pod if init container or volume is missing
+	if (initContainersMutated || containersMutated || hasWrappedContainers(pod)) && !dryRun {
+		level := mw.podSecurityLevel(ctx, ns)
+		if err = checkPodSecurity(pod, level); err != nil {
+			// Pod Security Admission exemptions are not known to the webhook: warn and let Pod Security Admission decide
+			logger.WithError(err).Warn("pod violates enforced Pod Security Standards")
+			warnings = append(warnings, err.Error())
+		}
+		if err = mw.injectSecretsInit(pod, level); err != nil {
+			return nil, errors.Wrapf(err, "failed to inject secrets-init into pod %s", pod.Name)
+		}
 	}
 
-	return nil
+	return warnings, nil
 }
 
 func getSecretsInitVolume(volumeName string) corev1.Volume {
@@ -349,17 +546,42 @@ func getSecretsInitVolume(volumeName string) corev1.Volume {
 }
 
 func isNewImage(image string) bool {
+	return checkImageVersion(image, ">= 0.4.0")
+}
+
+// latestImageConstraint secrets-init image version constraint of features not in a released secrets-init version
+// yet: only the latest image supports them
+const latestImageConstraint = "latest"
+
+// imageVersion returns secrets-init image tag, "latest" if image has no tag; fails for image pinned by digest
+// without tag, since its version is not known
+func imageVersion(image string) (string, error) {
+	base, _, pinned := strings.Cut(image, "@")
+	tag, err := name.NewTag(base)
+	if err != nil {
+		return "", errors.Wrapf(err, "invalid image %q", image)
+	}
+	if pinned && !strings.Contains(base[strings.LastIndex(base, "/")+1:], ":") {
+		return "", errors.Errorf("image %q is pinned by digest without tag, use <image>:<version>@<digest>", image)
+	}
+	return tag.TagStr(), nil
+}
+
+// checkImageVersion checks secrets-init image version against semver constraint; latest image satisfies any constraint
+func checkImageVersion(image, constraint string) bool {
 	const latest = "latest"
-	const verlen = 2
-	// get image version, "latest" by default
-	version := latest
-	iv := strings.Split(image, ":")
-	if len(iv) == verlen {
-		version = iv[1]
+	version, err := imageVersion(image)
+	if err != nil {
+		// unknown version: assume old image
+		log.WithError(err).Warn("unknown secrets-init image version")
+		return false
 	}
 	if version == latest {
 		return true
 	}
+	if constraint == latestImageConstraint {
+		return false
+	}
 	// construct semver
 	ver, err := semver.NewVersion(version)
 	if err != nil {
@@ -369,25 +591,27 @@ func isNewImage(image string) bool {
 	}
 
 	// check image version vs constraint
-	c, err := semver.NewConstraint(">= 0.4.0")
+	c, err := semver.NewConstraint(constraint)
 	if err != nil {
 		log.WithError(err).Warn("bad version constraint")
+		return false
 	}
 	return c.Check(ver)
 }
 
-func getSecretsInitContainer(image, pullPolicy, volumeName, volumePath string) corev1.Container {
+func getSecretsInitContainer(image, pullPolicy, volumeName, volumePath, os string) corev1.Container {
 	// default: secrets-init `FROM alpine` use system `cp` command to copy file to mounted volume
 	args := []string{"cp", "/usr/local/bin/secrets-init", volumePath}
 	// new: secrets-init >= 0.4.0 is build `FROM scratch` with `secrets-init` entrypoint
-	// use `secrets-init copy` command to copy file to mounted volume
-	if isNewImage(image) {
+	// use `secrets-init copy` command to copy file to mounted volume;
+	// Windows images have no `cp` and always use `secrets-init.exe copy`
+	if os == windowsOS || isNewImage(image) {
 		args = []string{"copy", volumePath}
 	}
 
 	// prepare initContainer
 	return corev1.Container{
-		Name:            "copy-secrets-init",
+		Name:            secretsInitContainerName,
 		Image:           image,
 		ImagePullPolicy: corev1.PullPolicy(pullPolicy),
 		Args:            args,
@@ -442,14 +666,15 @@ func before(c *cli.Context) error {
 	return nil
 }
 
-func (mw *mutatingWebhook) secretsMutator(_ context.Context, ar *whmodel.AdmissionReview, obj metav1.Object) (*mutating.MutatorResult, error) {
+func (mw *mutatingWebhook) secretsMutator(ctx context.Context, ar *whmodel.AdmissionReview, obj metav1.Object) (*mutating.MutatorResult, error) {
 	switch v := obj.(type) {
 	case *corev1.Pod:
-		err := mw.mutatePod(v, ar.Namespace, ar.DryRun)
+		ctx = withAdmissionUser(withAdmissionObjects(ctx), admissionUserInfo(ar))
+		warnings, err := mw.mutatePod(ctx, v, ar.Namespace, ar.DryRun)
 		if err != nil {
 			return nil, errors.Wrapf(err, "failed to mutate pod: %s", v.Name)
 		}
-		return &mutating.MutatorResult{MutatedObject: v}, nil
+		return &mutating.MutatorResult{MutatedObject: v, Warnings: warnings}, nil
 	default:
 		return &mutating.MutatorResult{}, nil
 	}
@@ -457,7 +682,7 @@ func (mw *mutatingWebhook) secretsMutator(_ context.Context, ar *whmodel.Admissi
 
 // mutation webhook server
 func runWebhook(c *cli.Context) error {
-	k8sClient, err := newK8SClient()
+	k8sClient, kubeConfig, err := newK8SClient()
 	if err != nil {
 		logger.WithError(err).Fatalf("error creating k8s client")
 	}
@@ -472,6 +697,109 @@ func runWebhook(c *cli.Context) error {
 		defaultImagePullSecretNamespace = c.String("default_image_pull_secret_namespace")
 	}
 
+	defaultPlatform, err := registry.ParsePlatform(c.String("default-platform"))
+	if err != nil {
+		return errors.Wrap(err, "invalid default-platform")
+	}
+
+	provider := c.String("provider")
+	if !isSupportedProvider(provider) {
+		return errors.Wrapf(ErrUnsupportedProvider, "%q", provider)
+	}
+
+	invalidReferences := c.String("invalid-references")
+	if !isPolicyAction(invalidReferences, policyDeny, policyWarn) {
+		return errors.Wrapf(ErrInvalidPolicyAction, "invalid-references: %q", invalidReferences)
+	}
+
+	secretExpansion := c.String("secret-expansion")
+	if !isPolicyAction(secretExpansion, policyRewrite, policyDeny, policyWarn) {
+		return errors.Wrapf(ErrInvalidPolicyAction, "secret-expansion: %q", secretExpansion)
+	}
+
+	if _, _, err = parsePolicyConfigMapRef(c.String("policy-configmap")); err != nil {
+		return err
+	}
+
+	secretAccess := c.String("secret-access")
+	if !isSecretAccess(secretAccess) {
+		return errors.Wrapf(ErrInvalidSecretAccess, "secret-access: %q", secretAccess)
+	}
+	secretAccessNamespaces, err := parseSecretAccessNamespaces(c.StringSlice("secret-access-namespace"))
+	if err != nil {
+		return err
+	}
+
+	objectAccess := c.String("object-access")
+	if !isObjectAccess(objectAccess) {
+		return errors.Wrapf(ErrInvalidObjectAccess, "object-access: %q", objectAccess)
+	}
+
+	overrideAllowlist, err := parseOverrideAllowlist(c.StringSlice("allow-override"))
+	if err != nil {
+		return err
+	}
+
+	nonLinuxPods := c.String("non-linux-pods")
+	if !isPolicyAction(nonLinuxPods, policySkip, policyDeny) {
+		return errors.Wrapf(ErrInvalidPolicyAction, "non-linux-pods: %q", nonLinuxPods)
+	}
+
+	osImages, err := parseOSImages(c.StringSlice("os-image"))
+	if err != nil {
+		return err
+	}
+
+	injectionMode := c.String("injection-mode")
+	if !isInjectionMode(injectionMode) {
+		return errors.Wrapf(ErrInvalidInjectionMode, "injection-mode: %q", injectionMode)
+	}
+	injectionModeNamespaces, err := parseInjectionModeNamespaces(c.StringSlice("injection-mode-namespace"))
+	if err != nil {
+		return err
+	}
+	modes := map[string]bool{injectionMode: true}
+	for _, mode := range injectionModeNamespaces {
+		modes[mode] = true
+	}
+	imageVolumes := false
+	if modes[injectionImageVolume] {
+		if imageVolumes, err = imageVolumeSupported(k8sClient.Discovery(), c.Bool("image-volume-feature-gate")); err != nil {
+			return err
+		}
+	}
+
+	preinstalledVolumeAllowlist, err := parsePreinstalledVolumeAllowlist(c.StringSlice("preinstalled-volume-allow"))
+	if err != nil {
+		return err
+	}
+	preinstalledVolume, err := parsePreinstalledVolume(c.String("preinstalled-volume"))
+	if err != nil {
+		return err
+	}
+	if preinstalledVolume != nil && !preinstalledVolumeAllowed(preinstalledVolume, preinstalledVolumeAllowlist) {
+		return errors.Wrapf(ErrPreinstalledVolumeNotAllowed, "preinstalled-volume: %s", volumeSourceName(preinstalledVolume))
+	}
+	if modes[injectionPreinstalled] && preinstalledVolume == nil {
+		return errors.Wrap(ErrInvalidPreinstalledVolume, "preinstalled injection mode requires preinstalled-volume")
+	}
+
+	initTemplate, err := loadHelperTemplate(context.Background(), k8sClient, c.String("helper-template"), c.String("helper-template-configmap"))
+	if err != nil {
+		return err
+	}
+
+	var objects *objectCache
+	if c.Bool("object-cache") {
+		labelSelector := c.String("object-cache-label-selector")
+		if _, err = labels.Parse(labelSelector); err != nil {
+			return errors.Wrapf(err, "invalid object-cache-label-selector: %q", labelSelector)
+		}
+		// Secrets are cached only if the webhook may read them cluster wide
+		objects = newObjectCache(k8sClient, c.StringSlice("object-cache-namespace"), labelSelector, secretAccess == secretAccessRead)
+		objects.start(make(chan struct{}), c.Duration("object-cache-sync-timeout"))
+	}
+
 	webhook := mutatingWebhook{
 		k8sClient: k8sClient,
 		registry: registry.NewRegistry(
@@ -479,12 +807,33 @@ func runWebhook(c *cli.Context) error {
 			c.String("docker-config-json-key"),
 			defaultImagePullSecret,
 			defaultImagePullSecretNamespace,
+			*defaultPlatform,
 		),
-		provider:   c.String("provider"),
-		image:      c.String("image"),
-		pullPolicy: c.String("pull-policy"),
-		volumeName: c.String("volume-name"),
-		volumePath: c.String("volume-path"),
+		provider:                    provider,
+		image:                       c.String("image"),
+		pullPolicy:                  c.String("pull-policy"),
+		volumeName:                  c.String("volume-name"),
+		volumePath:                  c.String("volume-path"),
+		invalidReferences:           invalidReferences,
+		policyConfigMap:             c.String("policy-configmap"),
+		secretExpansion:             secretExpansion,
+		objects:                     objects,
+		secretAccess:                secretAccess,
+		secretAccessNamespaces:      secretAccessNamespaces,
+		objectAccess:                objectAccess,
+		impersonate:                 impersonatingClientFunc(kubeConfig),
+		nonLinuxPods:                nonLinuxPods,
+		osImages:                    osImages,
+		helperTemplate:              initTemplate,
+		injectionMode:               injectionMode,
+		injectionModeNamespaces:     injectionModeNamespaces,
+		imageVolumesSupported:       imageVolumes,
+		imageVolumeSubPath:          c.String("image-volume-sub-path"),
+		preinstalledVolume:          preinstalledVolume,
+		preinstalledVolumeAllowlist: preinstalledVolumeAllowlist,
+		overrideAllowlist:           overrideAllowlist,
+		policyConfigs:               &policyConfigCache{},
+		namespaceLevels:             cache.NewLRUExpireCache(namespaceLevelCacheSize),
 	}
 
 	mutator := mutating.MutatorFunc(webhook.secretsMutator)
@@ -508,6 +857,19 @@ func runWebhook(c *cli.Context) error {
 
 	mux := http.NewServeMux()
 	mux.Handle("/pods", podHandler)
+	if c.Bool("ephemeral-containers") {
+		ephemeralContainersHandler := handlerFor(
+			mutating.WebhookConfig{
+				ID:      "init-secrets-ephemeral-containers",
+				Obj:     &corev1.Pod{},
+				Mutator: mutating.MutatorFunc(webhook.ephemeralContainersMutator),
+				Logger:  whlogrus.NewLogrus(log.NewEntry(logger)),
+			},
+			metricsRecorder,
+			logger,
+		)
+		mux.Handle("/pods/ephemeralcontainers", ephemeralContainersHandler)
+	}
 	mux.Handle("/healthz", http.HandlerFunc(healthzHandler))
 
 	telemetryAddress := c.String("telemetry-listen-address")
@@ -629,6 +991,11 @@ func main() {
 					Name:  "default-image-pull-secret-namespace",
 					Usage: "default image pull secret namespace",
 				},
+				cli.StringFlag{
+					Name:  "default-platform",
+					Usage: "platform (os/arch[/variant]) of multi-arch container image, if not constrained by pod node selector or node affinity",
+					Value: "linux/amd64",
+				},
 				cli.StringFlag{
 					Name:  "volume-name",
 					Usage: "mount volume name",
@@ -639,9 +1006,105 @@ func main() {
 					Usage: "mount volume path",
 					Value: binVolumePath,
 				},
+				cli.StringFlag{
+					Name:  "invalid-references",
+					Usage: "action for malformed secret references ['deny', 'warn']",
+					Value: policyDeny,
+				},
+				cli.StringFlag{
+					Name:  "secret-expansion",
+					Usage: "action for $(VAR) expansion of secret reference variables in container command and args ['rewrite', 'deny', 'warn']",
+					Value: policyRewrite,
+				},
+				cli.StringFlag{
+					Name:  "policy-configmap",
+					Usage: "<namespace>/<name> of ConfigMap with per namespace secret reference policy (disabled, if empty)",
+				},
+				cli.BoolFlag{
+					Name:  "object-cache",
+					Usage: "read ConfigMaps and Secrets from shared informer cache, falling back to API server for objects not in cache; requires list and watch permissions",
+				},
+				cli.DurationFlag{
+					Name:  "object-cache-sync-timeout",
+					Usage: "time to wait for object cache sync, before the cache is stopped and all objects are read from API server",
+					Value: 30 * time.Second,
+				},
+				cli.StringSliceFlag{
+					Name:  "object-cache-namespace",
+					Usage: "namespace to cache ConfigMaps and Secrets in; can be repeated (all namespaces, if not set)",
+				},
+				cli.StringFlag{
+					Name:  "object-cache-label-selector",
+					Usage: "label selector of ConfigMaps and Secrets to cache (all objects, if empty)",
+				},
+				cli.StringFlag{
+					Name:  "secret-access",
+					Usage: "read Secrets referenced by pod env ['read', 'none']; with 'none', pods request secrets-init for env from Secrets with the " + injectAnnotation + " annotation",
+					Value: secretAccessRead,
+				},
+				cli.StringSliceFlag{
+					Name:  "secret-access-namespace",
+					Usage: "per namespace secret access <namespace>=<read|none>; can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "object-access",
+					Usage: "whose permissions are used to read ConfigMaps and Secrets referenced by pod env ['webhook', 'impersonate', 'subject-access-review']",
+					Value: objectAccessWebhook,
+				},
+				cli.BoolFlag{
+					Name:  "ephemeral-containers",
+					Usage: "serve /pods/ephemeralcontainers to wrap ephemeral containers (kubectl debug) with secrets-init",
+				},
+				cli.StringSliceFlag{
+					Name:  "allow-override",
+					Usage: "allow pod annotations to override setting with values matching pattern <setting>=<pattern>, setting is one of ['provider', 'image', 'pull-policy', 'volume-name', 'volume-path']; can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "non-linux-pods",
+					Usage: "policy for pods and container images targeting OS without secrets-init image ['skip', 'deny']",
+					Value: policySkip,
+				},
+				cli.StringSliceFlag{
+					Name:  "os-image",
+					Usage: "secrets-init image for non-Linux OS <os>=<image>, e.g. windows=<image>; can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "helper-template",
+					Usage: "file with secrets-init init container template (resources, securityContext, env) and emptyDir volume settings",
+				},
+				cli.StringFlag{
+					Name:  "helper-template-configmap",
+					Usage: "<namespace>/<name> of ConfigMap with secrets-init init container template under the " + helperTemplateConfigMapKey + " key; read on start",
+				},
+				cli.StringFlag{
+					Name:  "injection-mode",
+					Usage: "how secrets-init binary is provided to containers ['copy' (init container and emptyDir volume), 'image-volume' (secrets-init image mounted as volume, falls back to copy if not supported), 'preinstalled' (node directory mounted with preinstalled-volume)]",
+					Value: injectionCopy,
+				},
+				cli.StringSliceFlag{
+					Name:  "injection-mode-namespace",
+					Usage: "per namespace injection mode <namespace>=<copy|image-volume|preinstalled>; can be repeated",
+				},
+				cli.BoolFlag{
+					Name:  "image-volume-feature-gate",
+					Usage: "assert ImageVolume feature gate is enabled on API server and kubelets (beta and disabled by default in Kubernetes 1.33 and 1.34); required by image-volume injection mode",
+				},
+				cli.StringFlag{
+					Name:  "image-volume-sub-path",
+					Usage: "directory with secrets-init binary in secrets-init image, mounted at volume-path in image-volume injection mode",
+					Value: "usr/local/bin",
+				},
+				cli.StringFlag{
+					Name:  "preinstalled-volume",
+					Usage: "hostPath or csi volume source (YAML or JSON) of node directory with secrets-init binary, mounted at volume-path in preinstalled injection mode",
+				},
+				cli.StringSliceFlag{
+					Name:  "preinstalled-volume-allow",
+					Usage: "allowed preinstalled volume source hostPath=<path pattern> or csi=<driver pattern>; applies to preinstalled-volume and to pod hostPath or csi volume-name volumes; can be repeated",
+				},
 				cli.StringFlag{
 					Name:  "provider, p",
-					Usage: "supported secrets manager provider ['aws', 'google']",
+					Usage: "default secrets manager provider ['aws', 'google', 'vault', 'azure'], used when provider cannot be derived from secret references",
 					Value: "aws",
 				},
 			},
@@ -649,6 +1112,42 @@ func main() {
 			Description: "run mutation admission webhook server",
 			Action:      runWebhook,
 		},
+		{
+			Name: "rbac",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "secret-access",
+					Usage: "read Secrets referenced by pod env ['read', 'none']",
+					Value: secretAccessRead,
+				},
+				cli.StringSliceFlag{
+					Name:  "secret-access-namespace",
+					Usage: "per namespace secret access <namespace>=<read|none>; can be repeated",
+				},
+				cli.StringFlag{
+					Name:  "object-access",
+					Usage: "whose permissions are used to read ConfigMaps and Secrets referenced by pod env ['webhook', 'impersonate', 'subject-access-review']",
+					Value: objectAccessWebhook,
+				},
+				cli.BoolFlag{
+					Name:  "object-cache",
+					Usage: "grant list and watch permissions on ConfigMaps and Secrets for the object cache",
+				},
+				cli.StringFlag{
+					Name:  "service-account",
+					Usage: "webhook ServiceAccount name",
+					Value: "secrets-init-webhook-sa",
+				},
+				cli.StringFlag{
+					Name:  "service-account-namespace",
+					Usage: "webhook ServiceAccount namespace",
+					Value: "default",
+				},
+			},
+			Usage:       "generate RBAC manifests",
+			Description: "print webhook RBAC manifests matching the secret access configuration",
+			Action:      generateRBAC,
+		},
 	}
 
 	// run main command
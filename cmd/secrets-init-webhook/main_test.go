@@ -4,10 +4,13 @@ import (
 	"context"
 	"fmt"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
 	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/registry"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -16,11 +19,12 @@ import (
 
 type MockRegistry struct {
 	Image v1.Config
+	OS    string
 }
 
 //nolint:lll
-func (r *MockRegistry) GetImageConfig(_ context.Context, _ kubernetes.Interface, _ string, _ *corev1.Container, _ *corev1.PodSpec) (*v1.Config, error) {
-	return &r.Image, nil
+func (r *MockRegistry) GetImageConfig(_ context.Context, _ kubernetes.Interface, _ string, _ *corev1.Container, _ *corev1.PodSpec) (*v1.ConfigFile, error) {
+	return &v1.ConfigFile{OS: r.OS, Config: r.Image}, nil
 }
 
 //nolint:funlen
@@ -36,7 +40,7 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 	}
 	type args struct {
 		containers []corev1.Container
-		podSpec    *corev1.PodSpec
+		pod        *corev1.Pod
 		ns         string
 	}
 	tests := []struct {
@@ -288,6 +292,40 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 			},
 			mutated: true,
 		},
+		{
+			name: "reject container with mixed provider references",
+			fields: fields{
+				k8sClient: fake.NewSimpleClientset(),
+				registry: &MockRegistry{
+					Image: v1.Config{},
+				},
+				provider:   "aws",
+				image:      secretsInitImage,
+				volumeName: binVolumeName,
+				volumePath: binVolumePath,
+				pullPolicy: string(corev1.PullIfNotPresent),
+			},
+			args: args{
+				containers: []corev1.Container{
+					{
+						Name:    "TestContainer",
+						Image:   "test-image",
+						Command: []string{"echo"},
+						Env: []corev1.EnvVar{
+							{
+								Name:  "awssecret",
+								Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/topsecret",
+							},
+							{
+								Name:  "gcpsecret",
+								Value: "gcp:secretmanager:projects/test/secrets/topsecret",
+							},
+						},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "not mutate container without secrets with correct prefix",
 			fields: fields{
@@ -343,7 +381,11 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 				volumePath: tt.fields.volumePath,
 				pullPolicy: tt.fields.pullPolicy,
 			}
-			got, err := mw.mutateContainers(tt.args.containers, tt.args.podSpec, tt.args.ns)
+			pod := tt.args.pod
+			if pod == nil {
+				pod = &corev1.Pod{}
+			}
+			got, _, err := mw.mutateContainers(context.TODO(), tt.args.containers, pod, tt.args.ns)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("mutatingWebhook.mutateContainers() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -355,6 +397,80 @@ func Test_mutatingWebhook_mutateContainers(t *testing.T) {
 	}
 }
 
+func Test_mutatingWebhook_selectProvider(t *testing.T) {
+	awsRef := &reference.SecretReference{Provider: reference.AWS}
+	googleRef := &reference.SecretReference{Provider: reference.Google}
+	tests := []struct {
+		name     string
+		provider string
+		envVars  []secretEnvVar
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "fallback to default provider",
+			provider: "aws",
+			envVars:  []secretEnvVar{{Reference: &reference.SecretReference{}}},
+			want:     "aws",
+		},
+		{
+			name:     "provider derived from references",
+			provider: "aws",
+			envVars:  []secretEnvVar{{Reference: googleRef}, {Reference: googleRef}},
+			want:     "google",
+		},
+		{
+			name:     "mixed providers",
+			provider: "aws",
+			envVars:  []secretEnvVar{{Reference: awsRef}, {Reference: googleRef}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{provider: tt.provider}
+			got, err := mw.selectProvider(tt.envVars)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mutatingWebhook.selectProvider() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("mutatingWebhook.selectProvider() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_lookupSecretEnvVar_template(t *testing.T) {
+	value := "postgres://app:${" + testSecretARN + "}@db:5432/app"
+	got := lookupSecretEnvVar("DSN", value, inlineEnvSource)
+	if got == nil || got.Reference != nil || len(got.Template) != 1 || got.Err != nil {
+		t.Fatalf("lookupSecretEnvVar() = %+v, want templated env var", got)
+	}
+	if args := templateArgs([]secretEnvVar{*got, *makeTestSecretEnvVar("PASSWORD", inlineEnvSource), *got}); !reflect.DeepEqual(args, []string{"--template-env=DSN"}) {
+		t.Errorf("templateArgs() = %v, want [--template-env=DSN]", args)
+	}
+}
+
+func Test_mutatingWebhook_checkReferences(t *testing.T) {
+	invalid := lookupSecretEnvVar("PASSWORD", "arn:aws:secretsmanager:us-east-1:secret:test/secret",
+		secretKeySource("test-ns", "db", "password"))
+	valid := makeTestSecretEnvVar("USER", inlineEnvSource)
+	wantMsg := "container app: env PASSWORD (from secret test-ns/db key password)"
+
+	mw := &mutatingWebhook{}
+	_, err := mw.checkReferences("app", []secretEnvVar{*valid, *invalid})
+	if !errors.Is(err, reference.ErrInvalidReference) || !strings.HasPrefix(err.Error(), wantMsg) {
+		t.Errorf("mutatingWebhook.checkReferences() error = %v, want %q", err, wantMsg)
+	}
+
+	mw = &mutatingWebhook{invalidReferences: policyWarn}
+	warnings, err := mw.checkReferences("app", []secretEnvVar{*valid, *invalid})
+	if err != nil || len(warnings) != 1 || !strings.HasPrefix(warnings[0], wantMsg) {
+		t.Errorf("mutatingWebhook.checkReferences() = %v, %v, want warning %q", warnings, err, wantMsg)
+	}
+}
+
 // helper function - make K8s Secret
 //nolint:unparam
 func makeSecret(namespace, name string, data map[string][]byte) *corev1.Secret {
@@ -380,6 +496,24 @@ func makeConfigMap(namespace, name string, data map[string]string) *corev1.Confi
 	}
 }
 
+const testSecretARN = "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret"
+
+// helper function - make secret env var referencing testSecretARN
+func makeTestSecretEnvVar(name, source string) *secretEnvVar {
+	return &secretEnvVar{
+		EnvVar: corev1.EnvVar{Name: name, Value: testSecretARN},
+		Source: source,
+		Reference: &reference.SecretReference{
+			Provider: reference.AWS,
+			Service:  "secretsmanager",
+			Account:  "123456789012",
+			Region:   "us-east-1",
+			Name:     "test/secret",
+			Raw:      testSecretARN,
+		},
+	}
+}
+
 //nolint:funlen
 func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 	type fields struct {
@@ -398,7 +532,7 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 		name    string
 		fields  fields
 		args    args
-		want    []corev1.EnvVar
+		want    []secretEnvVar
 		wantErr bool
 	}{
 		{
@@ -418,12 +552,7 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 					},
 				},
 			},
-			want: []corev1.EnvVar{
-				{
-					Name:  "password",
-					Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-				},
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("password", secretKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from secret, ignore non-cloud secret",
@@ -443,12 +572,7 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 					},
 				},
 			},
-			want: []corev1.EnvVar{
-				{
-					Name:  "password",
-					Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-				},
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("password", secretKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from configmap",
@@ -467,12 +591,7 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 					},
 				},
 			},
-			want: []corev1.EnvVar{
-				{
-					Name:  "password",
-					Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-				},
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("password", configMapKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from configmap, ignore non-cloud configmap",
@@ -492,12 +611,7 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 					},
 				},
 			},
-			want: []corev1.EnvVar{
-				{
-					Name:  "password",
-					Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-				},
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("password", configMapKeySource("test-ns", "test-secret", "password"))},
 		},
 	}
 	//nolint:dupl
@@ -511,13 +625,16 @@ func Test_mutatingWebhook_lookForEnvFrom(t *testing.T) {
 				volumeName: tt.fields.volumeName,
 				volumePath: tt.fields.volumePath,
 			}
-			got, err := mw.lookForEnvFrom(tt.args.envFrom, tt.args.ns)
+			result, err := mw.buildContainerEnv(context.TODO(), tt.args.envFrom, nil, tt.args.ns)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("mutatingWebhook.lookForEnvFrom() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("mutatingWebhook.buildContainerEnv() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("mutatingWebhook.lookForEnvFrom() = %v, want %v", got, tt.want)
+			if got := result.secretEnvVars(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mutatingWebhook.buildContainerEnv() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -541,7 +658,7 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 		name    string
 		fields  fields
 		args    args
-		want    *corev1.EnvVar
+		want    []secretEnvVar
 		wantErr bool
 	}{
 		{
@@ -565,10 +682,7 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 					},
 				},
 			},
-			want: &corev1.EnvVar{
-				Name:  "PASSWORD",
-				Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("PASSWORD", secretKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from secret, ignore non-cloud secret",
@@ -592,11 +706,7 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 					},
 				},
 			},
-			want: &corev1.EnvVar{
-
-				Name:  "PASSWORD",
-				Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("PASSWORD", secretKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from configmap",
@@ -619,11 +729,7 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 					},
 				},
 			},
-			want: &corev1.EnvVar{
-
-				Name:  "PASSWORD",
-				Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("PASSWORD", configMapKeySource("test-ns", "test-secret", "password"))},
 		},
 		{
 			name: "get value from configmap, ignore non-cloud configmap",
@@ -647,11 +753,7 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 					},
 				},
 			},
-			want: &corev1.EnvVar{
-
-				Name:  "PASSWORD",
-				Value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/secret",
-			},
+			want: []secretEnvVar{*makeTestSecretEnvVar("PASSWORD", configMapKeySource("test-ns", "test-secret", "password"))},
 		},
 	}
 	//nolint:dupl
@@ -665,13 +767,16 @@ func Test_mutatingWebhook_lookForValueFrom(t *testing.T) {
 				volumeName: tt.fields.volumeName,
 				volumePath: tt.fields.volumePath,
 			}
-			got, err := mw.lookForValueFrom(tt.args.envVar, tt.args.ns)
+			result, err := mw.buildContainerEnv(context.TODO(), nil, []corev1.EnvVar{tt.args.envVar}, tt.args.ns)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("mutatingWebhook.lookForEnvFrom() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("mutatingWebhook.buildContainerEnv() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("mutatingWebhook.lookForEnvFrom() = %v, want %v", got, tt.want)
+			if err != nil {
+				return
+			}
+			if got := result.secretEnvVars(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mutatingWebhook.buildContainerEnv() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -718,6 +823,31 @@ func Test_isNewImage(t *testing.T) {
 			image: "test:v0.2.9",
 			want:  false,
 		},
+		{
+			name:  "old version in registry with port",
+			image: "registry:5000/secrets-init:0.1.0",
+			want:  false,
+		},
+		{
+			name:  "new version in registry with port",
+			image: "registry:5000/secrets-init:0.4.0",
+			want:  true,
+		},
+		{
+			name:  "version pinned with digest",
+			image: "test:0.4.0@sha256:" + strings.Repeat("0", 64),
+			want:  true,
+		},
+		{
+			name:  "old version pinned with digest",
+			image: "registry:5000/test:0.1.0@sha256:" + strings.Repeat("0", 64),
+			want:  false,
+		},
+		{
+			name:  "digest without version",
+			image: "registry:5000/test@sha256:" + strings.Repeat("0", 64),
+			want:  false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -727,3 +857,23 @@ func Test_isNewImage(t *testing.T) {
 		})
 	}
 }
+
+func Test_checkImageVersion_latestImageConstraint(t *testing.T) {
+	tests := []struct {
+		image string
+		want  bool
+	}{
+		{image: "test", want: true},
+		{image: "registry:5000/test:latest", want: true},
+		{image: "test:latest@sha256:" + strings.Repeat("0", 64), want: true},
+		{image: "test:99.0.0"},
+		{image: "test@sha256:" + strings.Repeat("0", 64)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			if got := checkImageVersion(tt.image, latestImageConstraint); got != tt.want {
+				t.Errorf("checkImageVersion(%s) = %v, want %v", latestImageConstraint, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"path"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/pod-security-admission/api"
+)
+
+// secretsInitContainerName is the name of the injected init container copying secrets-init binary
+const secretsInitContainerName = "copy-secrets-init"
+
+// isWrapped checks container entrypoint is already secrets-init, mounted from a volume (or its sub directory)
+// by earlier mutation
+func isWrapped(container *corev1.Container) bool {
+	if len(container.Command) == 0 || strings.TrimSuffix(path.Base(container.Command[0]), ".exe") != "secrets-init" {
+		return false
+	}
+	dir := path.Dir(container.Command[0])
+	for _, mount := range container.VolumeMounts {
+		if mountPath := path.Clean(mount.MountPath); dir == mountPath || strings.HasPrefix(dir, mountPath+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWrappedContainers checks any pod container or init container is wrapped by earlier mutation
+func hasWrappedContainers(pod *corev1.Pod) bool {
+	for _, containers := range [][]corev1.Container{pod.Spec.InitContainers, pod.Spec.Containers} {
+		for i := range containers {
+			if isWrapped(&containers[i]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func hasContainer(containers []corev1.Container, name string) bool {
+	return containerIndex(containers, name) >= 0
+}
+
+// containerIndex returns index of named container; -1 if not found
+func containerIndex(containers []corev1.Container, name string) int {
+	for i, c := range containers {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// firstWrappedIndex returns index of the first container wrapped with secrets-init; len(containers) if none
+func firstWrappedIndex(containers []corev1.Container) int {
+	for i := range containers {
+		if isWrapped(&containers[i]) {
+			return i
+		}
+	}
+	return len(containers)
+}
+
+// podVolume returns named pod volume; nil if not found
+func podVolume(pod *corev1.Pod, name string) *corev1.Volume {
+	for i := range pod.Spec.Volumes {
+		if pod.Spec.Volumes[i].Name == name {
+			return &pod.Spec.Volumes[i]
+		}
+	}
+	return nil
+}
+
+func hasVolume(volumes []corev1.Volume, name string) bool {
+	for _, v := range volumes {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// injectSecretsInit adds secrets-init image or preinstalled volume, or secrets-init init container (as the first
+// init container) and volume, unless pod already has them after earlier mutation
+func (mw *mutatingWebhook) injectSecretsInit(pod *corev1.Pod, level api.LevelVersion) error {
+	switch mw.injectionMode {
+	case injectionImageVolume:
+		mw.injectImageVolume(pod)
+	case injectionPreinstalled:
+		if err := mw.injectPreinstalledVolume(pod, level); err != nil {
+			return err
+		}
+	default:
+		return mw.injectCopyContainer(pod, level)
+	}
+	return nil
+}
+
+// injectCopyContainer adds copy-secrets-init init container and emptyDir volume;
+// init container passes Pod Security Standards level
+func (mw *mutatingWebhook) injectCopyContainer(pod *corev1.Pod, level api.LevelVersion) error {
+	if index := containerIndex(pod.Spec.InitContainers, secretsInitContainerName); index > firstWrappedIndex(pod.Spec.InitContainers) {
+		// move secrets-init init container ahead of init containers and sidecars that use secrets-init
+		copyContainer := pod.Spec.InitContainers[index]
+		pod.Spec.InitContainers = append(pod.Spec.InitContainers[:index], pod.Spec.InitContainers[index+1:]...)
+		pod.Spec.InitContainers = append([]corev1.Container{copyContainer}, pod.Spec.InitContainers...)
+		logger.WithField("pod", pod.Name).Info("moved secrets-init init container ahead of init containers using it")
+	} else if index >= 0 {
+		logger.WithField("pod", pod.Name).Debug("pod already has secrets-init init container")
+	} else {
+		copyContainer, err := mw.helperTemplate.apply(getSecretsInitContainer(mw.image, mw.pullPolicy, mw.volumeName, mw.volumePath, mw.targetOS()))
+		if err != nil {
+			return err
+		}
+		if err = secureHelper(&copyContainer, &pod.Spec, level); err != nil {
+			return err
+		}
+		pod.Spec.InitContainers = append([]corev1.Container{copyContainer}, pod.Spec.InitContainers...)
+		logger.Debug("successfully prepended pod init containers to spec")
+	}
+	if hasVolume(pod.Spec.Volumes, mw.volumeName) {
+		logger.WithField("pod", pod.Name).Debug("pod already has secrets-init volume")
+	} else {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, mw.helperTemplate.volume(mw.volumeName))
+		logger.Debug("successfully appended pod spec volumes")
+	}
+	return nil
+}
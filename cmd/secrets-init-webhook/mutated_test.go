@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// helper function - make pod with init container and containers referencing testSecretARN
+func makeTestPod() *corev1.Pod {
+	container := func(name string) corev1.Container {
+		return corev1.Container{
+			Name:    name,
+			Command: []string{name},
+			Args:    []string{"--password=$(PASSWORD)"},
+			Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}},
+		}
+	}
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pod"},
+		Spec: corev1.PodSpec{
+			InitContainers: []corev1.Container{container("init")},
+			Containers:     []corev1.Container{container("app"), {Name: "sidecar", Image: "sidecar"}},
+		},
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_twice(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+	pod := makeTestPod()
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+	}
+	once := pod.DeepCopy()
+
+	if _, err := mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() second call error = %v", err)
+	}
+	if !reflect.DeepEqual(pod, once) {
+		t.Errorf("mutatingWebhook.mutatePod() second call changed pod:\n%+v\nwant\n%+v", pod.Spec, once.Spec)
+	}
+	if len(pod.Spec.InitContainers) != 2 || len(pod.Spec.Volumes) != 1 {
+		t.Errorf("pod has %d init containers and %d volumes, want 2 and 1", len(pod.Spec.InitContainers), len(pod.Spec.Volumes))
+	}
+}
+
+func Test_mutatingWebhook_mutatePod_repair(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+	want := makeTestPod()
+	if _, err := mw.mutatePod(context.TODO(), want, "test-ns", false); err != nil {
+		t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		damage func(pod *corev1.Pod)
+	}{
+		{
+			name: "missing init container and volume",
+			damage: func(pod *corev1.Pod) {
+				pod.Spec.InitContainers = pod.Spec.InitContainers[1:]
+				pod.Spec.Volumes = nil
+			},
+		},
+		{
+			name:   "missing volume",
+			damage: func(pod *corev1.Pod) { pod.Spec.Volumes = nil },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pod := want.DeepCopy()
+			tt.damage(pod)
+			if _, err := mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+			}
+			if !reflect.DeepEqual(pod, want) {
+				t.Errorf("mutatingWebhook.mutatePod() =\n%+v\nwant\n%+v", pod.Spec, want.Spec)
+			}
+		})
+	}
+}
+
+func Test_isWrapped(t *testing.T) {
+	mount := []corev1.VolumeMount{{Name: binVolumeName, MountPath: "/helper/bin/"}}
+	tests := []struct {
+		name      string
+		container corev1.Container
+		want      bool
+	}{
+		{name: "wrapped", container: corev1.Container{Command: []string{"/helper/bin/secrets-init"}, VolumeMounts: mount}, want: true},
+		{name: "no command", container: corev1.Container{VolumeMounts: mount}},
+		{name: "other command", container: corev1.Container{Command: []string{"/helper/bin/app"}, VolumeMounts: mount}},
+		{name: "secrets-init from image", container: corev1.Container{Command: []string{"/usr/local/bin/secrets-init"}, VolumeMounts: mount}},
+		{name: "secrets-init from volume sub directory", container: corev1.Container{Command: []string{"/helper/bin/usr/local/bin/secrets-init"}, VolumeMounts: mount}, want: true},
+		{name: "windows secrets-init", container: corev1.Container{Command: []string{"/helper/bin/secrets-init.exe"}, VolumeMounts: mount}, want: true},
+		{name: "secrets-init from sibling directory", container: corev1.Container{Command: []string{"/helper/binary/secrets-init"}, VolumeMounts: mount}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isWrapped(&tt.container); got != tt.want {
+				t.Errorf("isWrapped() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
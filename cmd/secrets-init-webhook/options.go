@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// optionAnnotationPrefix is the prefix of pod annotations with secrets-init runtime options
+const optionAnnotationPrefix = annotationPrefix + "option-"
+
+var (
+	// ErrUnknownOption pod annotation sets secrets-init option unknown to or not supported by secrets-init image
+	ErrUnknownOption = errors.New("unknown secrets-init option")
+	// ErrUnsupportedArgument webhook generated secrets-init argument is not supported by secrets-init image
+	ErrUnsupportedArgument = errors.New("secrets-init argument is not supported by secrets-init image")
+)
+
+// runtimeOption secrets-init runtime option set with secrets-init.doit-intl.com/option-<name> pod annotation;
+// option is passed to secrets-init either as an argument or as an env var of the wrapped container
+type runtimeOption struct {
+	// flag secrets-init argument name
+	flag string
+	// env wrapped container env var name
+	env string
+	// validate checks annotation value
+	validate func(value string) error
+	// constraint secrets-init image versions supporting the option; any version if empty
+	constraint string
+}
+
+// runtimeOptions schema of secrets-init runtime options, keyed by option name
+var runtimeOptions = map[string]runtimeOption{
+	"log-level":           {flag: "log-level", validate: validateLogLevel},
+	"json-log":            {flag: "json-log", validate: validateBool},
+	"exit-early":          {flag: "exit-early", validate: validateBool, constraint: latestImageConstraint},
+	"aws-region":          {env: "AWS_REGION", validate: validateAWSRegion},
+	"aws-endpoint-url":    {env: "AWS_ENDPOINT_URL", validate: validateEndpointURL, constraint: latestImageConstraint},
+	"google-endpoint-url": {env: "GOOGLE_SECRET_MANAGER_ENDPOINT", validate: validateEndpointURL, constraint: latestImageConstraint},
+}
+
+// generatedFlags secrets-init image versions supporting arguments generated by the webhook, keyed by argument name
+var generatedFlags = map[string]string{
+	"template-env":    latestImageConstraint,
+	"expand-args":     latestImageConstraint,
+	"vault-addr":      latestImageConstraint,
+	"vault-role":      latestImageConstraint,
+	"vault-auth-path": latestImageConstraint,
+	"azure-client-id": latestImageConstraint,
+}
+
+// supportedBy checks secrets-init image version satisfies constraint; any version if constraint is empty
+func supportedBy(image, constraint string) bool {
+	return constraint == "" || checkImageVersion(image, constraint)
+}
+
+func validateLogLevel(value string) error {
+	_, err := log.ParseLevel(value)
+	return err
+}
+
+func validateBool(value string) error {
+	_, err := strconv.ParseBool(value)
+	return err
+}
+
+func validateAWSRegion(value string) error {
+	if !reference.AWSRegionRegexp.MatchString(value) {
+		return errors.New("not an AWS region")
+	}
+	return nil
+}
+
+func validateEndpointURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("not an http(s) URL")
+	}
+	return nil
+}
+
+// optionNames returns names of runtime options supported by secrets-init image
+func optionNames(image string) []string {
+	var names []string
+	for name, option := range runtimeOptions {
+		if supportedBy(image, option.constraint) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runtimeOptionArgs returns secrets-init arguments and wrapped container env vars for runtime options set
+// with pod annotations; unknown options, options not supported by secrets-init image and invalid values are rejected
+func (mw *mutatingWebhook) runtimeOptionArgs(pod *corev1.Pod) ([]string, []corev1.EnvVar, error) {
+	var names []string
+	for annotation := range pod.Annotations {
+		if name := strings.TrimPrefix(annotation, optionAnnotationPrefix); name != annotation {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	var args []string
+	var env []corev1.EnvVar
+	for _, name := range names {
+		annotation := optionAnnotationPrefix + name
+		option, ok := runtimeOptions[name]
+		if !ok || !supportedBy(mw.image, option.constraint) {
+			return nil, nil, errors.Wrapf(ErrUnknownOption, "%s: secrets-init image %s supports %v", annotation, mw.image, optionNames(mw.image))
+		}
+		value := pod.Annotations[annotation]
+		if err := option.validate(value); err != nil {
+			return nil, nil, errors.Wrapf(ErrInvalidAnnotation, "%s: %q: %v", annotation, value, err)
+		}
+		if option.flag != "" {
+			args = append(args, fmt.Sprintf("--%s=%s", option.flag, value))
+		} else {
+			env = append(env, corev1.EnvVar{Name: option.env, Value: value})
+		}
+	}
+	return args, env, nil
+}
+
+// checkGeneratedArgs checks secrets-init arguments generated by the webhook against secrets-init image version
+func checkGeneratedArgs(image string, args []string) error {
+	for _, arg := range args {
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if constraint, ok := generatedFlags[name]; ok && !supportedBy(image, constraint) {
+			return errors.Wrapf(ErrUnsupportedArgument, "--%s: secrets-init image %s, want %s", name, image, constraint)
+		}
+	}
+	return nil
+}
+
+// setEnv sets container env vars, replacing env vars with the same name
+func setEnv(container *corev1.Container, env []corev1.EnvVar) {
+	for _, e := range env {
+		replaced := false
+		for i := range container.Env {
+			if container.Env[i].Name == e.Name {
+				container.Env[i] = e
+				replaced = true
+			}
+		}
+		if !replaced {
+			container.Env = append(container.Env, e)
+		}
+	}
+}
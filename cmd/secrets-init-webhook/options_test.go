@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func Test_mutatingWebhook_runtimeOptionArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		image       string
+		annotations map[string]string
+		wantArgs    []string
+		wantEnv     []corev1.EnvVar
+		wantErr     bool
+	}{
+		{
+			name:  "no options",
+			image: secretsInitImage,
+			annotations: map[string]string{
+				injectAnnotation: "true",
+			},
+		},
+		{
+			name:  "arguments and env vars",
+			image: secretsInitImage,
+			annotations: map[string]string{
+				optionAnnotationPrefix + "log-level":        "debug",
+				optionAnnotationPrefix + "json-log":         "true",
+				optionAnnotationPrefix + "exit-early":       "true",
+				optionAnnotationPrefix + "aws-region":       "eu-west-1",
+				optionAnnotationPrefix + "aws-endpoint-url": "http://localstack:4566",
+			},
+			wantArgs: []string{"--exit-early=true", "--json-log=true", "--log-level=debug"},
+			wantEnv: []corev1.EnvVar{
+				{Name: "AWS_ENDPOINT_URL", Value: "http://localstack:4566"},
+				{Name: "AWS_REGION", Value: "eu-west-1"},
+			},
+		},
+		{
+			name:        "option supported by image version",
+			image:       "doitintl/secrets-init:0.4.2",
+			annotations: map[string]string{optionAnnotationPrefix + "aws-region": "us-gov-west-1"},
+			wantEnv:     []corev1.EnvVar{{Name: "AWS_REGION", Value: "us-gov-west-1"}},
+		},
+		{
+			name:        "option not supported by image version",
+			image:       "doitintl/secrets-init:0.4.2",
+			annotations: map[string]string{optionAnnotationPrefix + "exit-early": "true"},
+			wantErr:     true,
+		},
+		{
+			name:        "unknown option",
+			image:       secretsInitImage,
+			annotations: map[string]string{optionAnnotationPrefix + "debug": "true"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid log level",
+			image:       secretsInitImage,
+			annotations: map[string]string{optionAnnotationPrefix + "log-level": "verbose"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid AWS region",
+			image:       secretsInitImage,
+			annotations: map[string]string{optionAnnotationPrefix + "aws-region": "eu-west-1 --provider=google"},
+			wantErr:     true,
+		},
+		{
+			name:        "invalid endpoint URL",
+			image:       secretsInitImage,
+			annotations: map[string]string{optionAnnotationPrefix + "google-endpoint-url": "localhost:8080"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{image: tt.image}
+			pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tt.annotations}}
+			args, env, err := mw.runtimeOptionArgs(pod)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mutatingWebhook.runtimeOptionArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("mutatingWebhook.runtimeOptionArgs() args = %v, want %v", args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(env, tt.wantEnv) {
+				t.Errorf("mutatingWebhook.runtimeOptionArgs() env = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func Test_setEnv(t *testing.T) {
+	container := &corev1.Container{Env: []corev1.EnvVar{
+		{Name: "AWS_REGION", ValueFrom: &corev1.EnvVarSource{ConfigMapKeyRef: &corev1.ConfigMapKeySelector{Key: "region"}}},
+		{Name: "PASSWORD", Value: testSecretARN},
+	}}
+	setEnv(container, []corev1.EnvVar{{Name: "AWS_REGION", Value: "eu-west-1"}, {Name: "AWS_ENDPOINT_URL", Value: "http://localstack:4566"}})
+	want := []corev1.EnvVar{
+		{Name: "AWS_REGION", Value: "eu-west-1"},
+		{Name: "PASSWORD", Value: testSecretARN},
+		{Name: "AWS_ENDPOINT_URL", Value: "http://localstack:4566"},
+	}
+	if !reflect.DeepEqual(container.Env, want) {
+		t.Errorf("setEnv() env = %v, want %v", container.Env, want)
+	}
+}
+
+func Test_checkGeneratedArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   string
+		args    []string
+		wantErr bool
+	}{
+		{name: "latest image", image: secretsInitImage, args: []string{"--provider=vault", "--vault-role=app", "--template-env=DSN"}},
+		{name: "latest image with digest", image: secretsInitImage + "@sha256:" + strings.Repeat("0", 64), args: []string{"--provider=azure", "--azure-client-id=id", "--expand-args=PASSWORD"}},
+		{name: "released image with azure client id", image: "doitintl/secrets-init:0.5.0", args: []string{"--provider=azure", "--azure-client-id=id"}, wantErr: true},
+		{name: "old image without generated flags", image: "doitintl/secrets-init:0.4.2", args: []string{"--provider=aws"}},
+		{name: "old image with template env", image: "doitintl/secrets-init:0.4.2", args: []string{"--provider=aws", "--template-env=DSN"}, wantErr: true},
+		{name: "old image with expand args", image: "doitintl/secrets-init:0.4.2", args: []string{"--provider=google", "--expand-args=PASSWORD"}, wantErr: true},
+		{name: "old image with vault role", image: "doitintl/secrets-init:0.4.2", args: []string{"--provider=vault", "--vault-role=app"}, wantErr: true},
+		{name: "old image with azure client id", image: "doitintl/secrets-init:0.4.2", args: []string{"--provider=azure", "--azure-client-id=id"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkGeneratedArgs(tt.image, tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkGeneratedArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !errors.Is(err, ErrUnsupportedArgument) {
+				t.Errorf("checkGeneratedArgs() error = %v, want %v", err, ErrUnsupportedArgument)
+			}
+		})
+	}
+}
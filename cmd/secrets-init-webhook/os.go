@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/registry"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// linuxOS OS of the default secrets-init image
+	linuxOS = "linux"
+	// windowsOS OS of Windows secrets-init image, with secrets-init.exe entrypoint
+	windowsOS = "windows"
+)
+
+// policySkip non-Linux pods are admitted unchanged
+const policySkip = "skip"
+
+var (
+	// ErrUnsupportedOS pod or container image targets OS without secrets-init image
+	ErrUnsupportedOS = errors.New("no secrets-init image for OS")
+	// ErrInvalidOSImage malformed per OS secrets-init image
+	ErrInvalidOSImage = errors.New("invalid OS image")
+)
+
+// imageOSError container image is built for another OS than secrets-init image
+type imageOSError struct {
+	container string
+	os        string
+}
+
+func (e *imageOSError) Error() string {
+	return fmt.Sprintf("container %s image is built for %s", e.container, e.os)
+}
+
+// parseOSImages parses <os>=<image> values into secrets-init images keyed by OS
+func parseOSImages(values []string) (map[string]string, error) {
+	images := map[string]string{}
+	for _, value := range values {
+		os, image, ok := strings.Cut(value, "=")
+		if !ok || os == "" || image == "" {
+			return nil, errors.Wrapf(ErrInvalidOSImage, "expected <os>=<image>, got %q", value)
+		}
+		images[os] = image
+	}
+	return images, nil
+}
+
+// podOS returns OS the pod targets with spec.os.name, node selector or node affinity; empty if not known
+func podOS(pod *corev1.Pod) string {
+	return registry.PodOS(&pod.Spec)
+}
+
+// targetOS returns OS of secrets-init image the webhook injects
+func (mw *mutatingWebhook) targetOS() string {
+	if mw.os == "" {
+		return linuxOS
+	}
+	return mw.os
+}
+
+// secretsInitBinary returns file name of secrets-init binary for the target OS
+func (mw *mutatingWebhook) secretsInitBinary() string {
+	if mw.targetOS() == windowsOS {
+		return "secrets-init.exe"
+	}
+	return "secrets-init"
+}
+
+// imagePodSpec returns pod spec to select image of multi-arch image with: pod with unknown OS targets OS of
+// secrets-init image for non-Linux OS
+func (mw *mutatingWebhook) imagePodSpec(pod *corev1.Pod) *corev1.PodSpec {
+	if mw.os == "" || podOS(pod) != "" {
+		return &pod.Spec
+	}
+	spec := pod.Spec
+	spec.OS = &corev1.PodOS{Name: corev1.OSName(mw.os)}
+	return &spec
+}
+
+// indexOS returns OS of multi-arch image without image for target OS: the first one with secrets-init image
+func (mw *mutatingWebhook) indexOS(oses []string) string {
+	for _, os := range oses {
+		if _, ok := mw.osImages[os]; ok {
+			return os
+		}
+	}
+	return oses[0]
+}
+
+// forOS returns webhook that injects secrets-init image for the OS
+func (mw *mutatingWebhook) forOS(os string) (*mutatingWebhook, error) {
+	if os == "" || os == mw.targetOS() {
+		return mw, nil
+	}
+	image, ok := mw.osImages[os]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnsupportedOS, "%q", os)
+	}
+	osWebhook := *mw
+	osWebhook.os = os
+	osWebhook.image = image
+	return &osWebhook, nil
+}
+
+// skipNonLinux admits pod targeting unsupported OS unchanged, or denies it with nonLinuxPods deny policy
+func (mw *mutatingWebhook) skipNonLinux(pod *corev1.Pod, err error) ([]string, error) {
+	if mw.nonLinuxPods == policyDeny {
+		return nil, errors.Wrapf(err, "pod %s cannot use secrets-init", pod.Name)
+	}
+	logger.WithField("pod", pod.Name).WithError(err).Info("skip mutation of pod")
+	return nil, nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/registry"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const testWindowsImage = "doitintl/secrets-init-windows:latest"
+
+func Test_mutatingWebhook_mutatePod_os(t *testing.T) {
+	windowsPod := func() *corev1.Pod {
+		pod := makeTestPod()
+		pod.Spec.OS = &corev1.PodOS{Name: corev1.Windows}
+		return pod
+	}
+	windowsNodePod := func() *corev1.Pod {
+		pod := makeTestPod()
+		pod.Spec.NodeSelector = map[string]string{corev1.LabelOSStable: "windows"}
+		return pod
+	}
+	// container command is taken from image config
+	imageCommandPod := func() *corev1.Pod {
+		pod := makeTestPod()
+		pod.Spec.Containers[0].Command = nil
+		return pod
+	}
+	linuxImageCommandPod := func() *corev1.Pod {
+		pod := imageCommandPod()
+		pod.Spec.OS = &corev1.PodOS{Name: corev1.Linux}
+		return pod
+	}
+	tests := []struct {
+		name         string
+		pod          *corev1.Pod
+		imageOS      string
+		nonLinuxPods string
+		osImages     map[string]string
+		wantMutated  bool
+		wantImage    string
+		wantErr      bool
+	}{
+		{
+			name:        "linux pod",
+			pod:         makeTestPod(),
+			wantMutated: true,
+			wantImage:   secretsInitImage,
+		},
+		{
+			name:         "skip windows pod",
+			pod:          windowsPod(),
+			nonLinuxPods: policySkip,
+		},
+		{
+			name:         "deny windows node pod",
+			pod:          windowsNodePod(),
+			nonLinuxPods: policyDeny,
+			wantErr:      true,
+		},
+		{
+			name:        "windows pod with windows image",
+			pod:         windowsPod(),
+			osImages:    map[string]string{"windows": testWindowsImage},
+			wantMutated: true,
+			wantImage:   testWindowsImage,
+		},
+		{
+			name:    "skip windows container image",
+			pod:     imageCommandPod(),
+			imageOS: "windows",
+		},
+		{
+			name:         "deny windows container image",
+			pod:          imageCommandPod(),
+			imageOS:      "windows",
+			nonLinuxPods: policyDeny,
+			wantErr:      true,
+		},
+		{
+			name:        "windows container image with windows image",
+			pod:         imageCommandPod(),
+			imageOS:     "windows",
+			osImages:    map[string]string{"windows": testWindowsImage},
+			wantMutated: true,
+			wantImage:   testWindowsImage,
+		},
+		{
+			name:     "windows container image of linux pod",
+			pod:      linuxImageCommandPod(),
+			imageOS:  "windows",
+			osImages: map[string]string{"windows": testWindowsImage},
+		},
+		{
+			name:        "linux container image",
+			pod:         imageCommandPod(),
+			imageOS:     linuxOS,
+			wantMutated: true,
+			wantImage:   secretsInitImage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:    fake.NewSimpleClientset(),
+				registry:     &MockRegistry{Image: v1.Config{Entrypoint: []string{"app"}}, OS: tt.imageOS},
+				provider:     "aws",
+				image:        secretsInitImage,
+				volumeName:   binVolumeName,
+				volumePath:   binVolumePath,
+				nonLinuxPods: tt.nonLinuxPods,
+				osImages:     tt.osImages,
+			}
+			original := tt.pod.DeepCopy()
+			_, err := mw.mutatePod(context.TODO(), tt.pod, "test-ns", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantMutated {
+				if !reflect.DeepEqual(tt.pod, original) {
+					t.Errorf("mutatingWebhook.mutatePod() changed pod: %+v", tt.pod.Spec)
+				}
+				return
+			}
+			if index := containerIndex(tt.pod.Spec.InitContainers, secretsInitContainerName); index < 0 {
+				t.Errorf("pod has no secrets-init init container")
+			} else if got := tt.pod.Spec.InitContainers[index].Image; got != tt.wantImage {
+				t.Errorf("secrets-init image = %q, want %q", got, tt.wantImage)
+			}
+			checkSecretsInitOS(t, tt.pod, tt.wantImage == testWindowsImage)
+		})
+	}
+}
+
+// helper function - check wrapped container command matches secrets-init image OS
+func checkSecretsInitOS(t *testing.T, pod *corev1.Pod, windows bool) {
+	t.Helper()
+	wantCommand := binVolumePath + "/secrets-init"
+	if windows {
+		wantCommand = binVolumePath + "/secrets-init.exe"
+	}
+	if got := pod.Spec.Containers[0].Command; len(got) == 0 || got[0] != wantCommand {
+		t.Errorf("container command = %v, want %s", got, wantCommand)
+	}
+}
+
+// multiArchRegistry serves multi-arch images with images for OSes only
+type multiArchRegistry struct {
+	oses []string
+}
+
+//nolint:lll
+func (r *multiArchRegistry) GetImageConfig(_ context.Context, _ kubernetes.Interface, _ string, container *corev1.Container, podSpec *corev1.PodSpec) (*v1.ConfigFile, error) {
+	platform := registry.PodPlatform(podSpec, v1.Platform{OS: linuxOS, Architecture: "amd64"})
+	for _, os := range r.oses {
+		if os == platform.OS {
+			return &v1.ConfigFile{OS: os, Config: v1.Config{Entrypoint: []string{"app"}}}, nil
+		}
+	}
+	return nil, &registry.PlatformError{Image: container.Image, Platform: platform, OSes: r.oses}
+}
+
+func Test_mutatingWebhook_mutatePod_multiArchOS(t *testing.T) {
+	tests := []struct {
+		name         string
+		oses         []string
+		nonLinuxPods string
+		osImages     map[string]string
+		wantMutated  bool
+		wantImage    string
+		wantErr      bool
+	}{
+		{
+			name:        "linux image",
+			oses:        []string{linuxOS, windowsOS},
+			wantMutated: true,
+			wantImage:   secretsInitImage,
+		},
+		{
+			name: "skip windows only image",
+			oses: []string{windowsOS},
+		},
+		{
+			name:         "deny windows only image",
+			oses:         []string{windowsOS},
+			nonLinuxPods: policyDeny,
+			wantErr:      true,
+		},
+		{
+			name:        "windows only image with windows image",
+			oses:        []string{windowsOS},
+			osImages:    map[string]string{windowsOS: testWindowsImage},
+			wantMutated: true,
+			wantImage:   testWindowsImage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:    fake.NewSimpleClientset(),
+				registry:     &multiArchRegistry{oses: tt.oses},
+				provider:     "aws",
+				image:        secretsInitImage,
+				volumeName:   binVolumeName,
+				volumePath:   binVolumePath,
+				nonLinuxPods: tt.nonLinuxPods,
+				osImages:     tt.osImages,
+			}
+			pod := makeTestPod()
+			pod.Spec.Containers[0].Command = nil
+			original := pod.DeepCopy()
+			_, err := mw.mutatePod(context.TODO(), pod, "test-ns", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrUnsupportedOS) {
+					t.Errorf("mutatingWebhook.mutatePod() error = %v, want %v", err, ErrUnsupportedOS)
+				}
+				return
+			}
+			if !tt.wantMutated {
+				if !reflect.DeepEqual(pod, original) {
+					t.Errorf("mutatingWebhook.mutatePod() changed pod: %+v", pod.Spec)
+				}
+				return
+			}
+			if index := containerIndex(pod.Spec.InitContainers, secretsInitContainerName); index < 0 {
+				t.Fatalf("pod has no secrets-init init container")
+			} else if got := pod.Spec.InitContainers[index].Image; got != tt.wantImage {
+				t.Errorf("secrets-init image = %q, want %q", got, tt.wantImage)
+			}
+			checkSecretsInitOS(t, pod, tt.wantImage == testWindowsImage)
+		})
+	}
+}
+
+func Test_getSecretsInitContainer_os(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    string
+		os       string
+		wantArgs []string
+	}{
+		{
+			name:     "old linux image",
+			image:    "doitintl/secrets-init:0.3.0",
+			os:       linuxOS,
+			wantArgs: []string{"cp", "/usr/local/bin/secrets-init", binVolumePath},
+		},
+		{
+			name:     "new linux image",
+			image:    secretsInitImage,
+			os:       linuxOS,
+			wantArgs: []string{"copy", binVolumePath},
+		},
+		{
+			name:     "windows image",
+			image:    "doitintl/secrets-init-windows:ltsc2022",
+			os:       windowsOS,
+			wantArgs: []string{"copy", binVolumePath},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := getSecretsInitContainer(tt.image, "", binVolumeName, binVolumePath, tt.os)
+			if !reflect.DeepEqual(got.Args, tt.wantArgs) {
+				t.Errorf("getSecretsInitContainer() args = %v, want %v", got.Args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func Test_parseOSImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  []string
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "windows image",
+			values: []string{"windows=" + testWindowsImage},
+			want:   map[string]string{"windows": testWindowsImage},
+		},
+		{
+			name:    "missing image",
+			values:  []string{"windows="},
+			wantErr: true,
+		},
+		{
+			name:    "missing os",
+			values:  []string{testWindowsImage},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseOSImages(tt.values)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("parseOSImages() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseOSImages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// pod annotations overriding webhook settings
+const (
+	// providerAnnotation default secrets manager provider, used when provider cannot be derived from secret references
+	providerAnnotation = annotationPrefix + "provider"
+	// imageAnnotation Docker image with secrets-init utility on board
+	imageAnnotation = annotationPrefix + "image"
+	// pullPolicyAnnotation secrets-init image pull policy
+	pullPolicyAnnotation = annotationPrefix + "pull-policy"
+	// volumeNameAnnotation secrets-init volume name
+	volumeNameAnnotation = annotationPrefix + "volume-name"
+	// volumePathAnnotation secrets-init volume mount path
+	volumePathAnnotation = annotationPrefix + "volume-path"
+)
+
+// overridableSettings webhook settings that can be overridden with pod annotations, keyed by setting name
+var overridableSettings = map[string]string{
+	"provider":    providerAnnotation,
+	"image":       imageAnnotation,
+	"pull-policy": pullPolicyAnnotation,
+	"volume-name": volumeNameAnnotation,
+	"volume-path": volumePathAnnotation,
+}
+
+// ErrOverrideNotAllowed pod annotation overrides webhook setting with value not allowed by operator
+var ErrOverrideNotAllowed = errors.New("setting override not allowed")
+
+// parseOverrideAllowlist parses <setting>=<pattern> values into allowed value patterns, keyed by setting name;
+// patterns use path.Match syntax
+func parseOverrideAllowlist(values []string) (map[string][]string, error) {
+	allowlist := map[string][]string{}
+	for _, value := range values {
+		setting, pattern, ok := strings.Cut(value, "=")
+		if _, known := overridableSettings[setting]; !ok || !known {
+			return nil, errors.Wrapf(ErrInvalidAnnotation, "expected <setting>=<pattern> for one of [%s], got %q",
+				strings.Join(overridableSettingNames(), ", "), value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s override pattern %q", setting, pattern)
+		}
+		allowlist[setting] = append(allowlist[setting], pattern)
+	}
+	return allowlist, nil
+}
+
+func overridableSettingNames() []string {
+	names := make([]string, 0, len(overridableSettings))
+	for name := range overridableSettings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// overrideAllowed checks value matches one of allowed patterns for the setting
+func (mw *mutatingWebhook) overrideAllowed(setting, value string) bool {
+	for _, pattern := range mw.overrideAllowlist[setting] {
+		if matched, _ := path.Match(pattern, value); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// validateOverride checks overridden setting value is valid
+func validateOverride(setting, value string) error {
+	switch setting {
+	case "provider":
+		if !isSupportedProvider(value) {
+			return ErrUnsupportedProvider
+		}
+	case "pull-policy":
+		switch corev1.PullPolicy(value) {
+		case corev1.PullAlways, corev1.PullIfNotPresent, corev1.PullNever:
+		default:
+			return errors.New("unknown pull policy")
+		}
+	case "volume-name":
+		if errs := validation.IsDNS1123Label(value); len(errs) != 0 {
+			return errors.New(strings.Join(errs, "; "))
+		}
+	case "volume-path":
+		if !path.IsAbs(value) {
+			return errors.New("volume path must be absolute")
+		}
+	case "image":
+		if value == "" {
+			return errors.New("image must not be empty")
+		}
+	}
+	return nil
+}
+
+// withPodOverrides returns webhook with settings overridden by pod annotations;
+// every override must be allowed by the operator allowlist
+func (mw *mutatingWebhook) withPodOverrides(pod *corev1.Pod) (*mutatingWebhook, error) {
+	podWebhook := *mw
+	settings := map[string]*string{
+		"provider":    &podWebhook.provider,
+		"image":       &podWebhook.image,
+		"pull-policy": &podWebhook.pullPolicy,
+		"volume-name": &podWebhook.volumeName,
+		"volume-path": &podWebhook.volumePath,
+	}
+	for _, setting := range overridableSettingNames() {
+		annotation := overridableSettings[setting]
+		value, ok := pod.Annotations[annotation]
+		if !ok {
+			continue
+		}
+		if err := validateOverride(setting, value); err != nil {
+			return nil, errors.Wrapf(ErrInvalidAnnotation, "%s: %q: %v", annotation, value, err)
+		}
+		if !mw.overrideAllowed(setting, value) {
+			return nil, errors.Wrapf(ErrOverrideNotAllowed, "%s: %q", annotation, value)
+		}
+		logger.WithField("pod", pod.Name).Debugf("%s is overridden with %q", setting, value)
+		*settings[setting] = value
+	}
+	return &podWebhook, nil
+}
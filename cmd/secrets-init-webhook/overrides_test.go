@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+//nolint:funlen
+func Test_mutatingWebhook_mutatePod_overrides(t *testing.T) {
+	allowlist := map[string][]string{
+		"provider":    {"*"},
+		"image":       {"doitintl/secrets-init:*"},
+		"pull-policy": {string(corev1.PullAlways)},
+		"volume-path": {"/helper/*"},
+	}
+	secretKeyRef := corev1.EnvVar{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}, Key: "password"}}}
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		env           []corev1.EnvVar
+		wantImage     string
+		wantPolicy    corev1.PullPolicy
+		wantCommand   []string
+		wantArgs      []string
+		wantMountPath string
+		wantErr       error
+	}{
+		{
+			name:          "no overrides",
+			wantImage:     "doitintl/secrets-init:0.4.0",
+			wantPolicy:    corev1.PullIfNotPresent,
+			wantCommand:   []string{"/helper/bin/secrets-init"},
+			wantArgs:      []string{"--provider=google", "echo"},
+			wantMountPath: "/helper/bin",
+		},
+		{
+			name: "allowed overrides",
+			annotations: map[string]string{
+				imageAnnotation:      "doitintl/secrets-init:0.5.0-rc1",
+				pullPolicyAnnotation: string(corev1.PullAlways),
+				volumePathAnnotation: "/helper/test",
+			},
+			wantImage:     "doitintl/secrets-init:0.5.0-rc1",
+			wantPolicy:    corev1.PullAlways,
+			wantCommand:   []string{"/helper/test/secrets-init"},
+			wantArgs:      []string{"--provider=google", "echo"},
+			wantMountPath: "/helper/test",
+		},
+		{
+			name:          "provider override, provider is not derived from references",
+			annotations:   map[string]string{providerAnnotation: "google", injectAnnotation: "true"},
+			env:           []corev1.EnvVar{secretKeyRef},
+			wantImage:     "doitintl/secrets-init:0.4.0",
+			wantPolicy:    corev1.PullIfNotPresent,
+			wantCommand:   []string{"/helper/bin/secrets-init"},
+			wantArgs:      []string{"--provider=google", "echo"},
+			wantMountPath: "/helper/bin",
+		},
+		{
+			name:          "provider override, provider is derived from references",
+			annotations:   map[string]string{providerAnnotation: "vault"},
+			wantImage:     "doitintl/secrets-init:0.4.0",
+			wantPolicy:    corev1.PullIfNotPresent,
+			wantCommand:   []string{"/helper/bin/secrets-init"},
+			wantArgs:      []string{"--provider=google", "echo"},
+			wantMountPath: "/helper/bin",
+		},
+		{
+			name:        "image not in allowlist",
+			annotations: map[string]string{imageAnnotation: "example.com/secrets-init:latest"},
+			wantErr:     ErrOverrideNotAllowed,
+		},
+		{
+			name:        "setting not in allowlist",
+			annotations: map[string]string{volumeNameAnnotation: "other-volume"},
+			wantErr:     ErrOverrideNotAllowed,
+		},
+		{
+			name:        "invalid pull policy",
+			annotations: map[string]string{pullPolicyAnnotation: "Sometimes"},
+			wantErr:     ErrInvalidAnnotation,
+		},
+		{
+			name:        "unsupported provider",
+			annotations: map[string]string{providerAnnotation: "keepass"},
+			wantErr:     ErrInvalidAnnotation,
+		},
+		{
+			name:        "relative volume path",
+			annotations: map[string]string{volumePathAnnotation: "helper/test"},
+			wantErr:     ErrInvalidAnnotation,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:         fake.NewSimpleClientset(),
+				registry:          &MockRegistry{Image: v1.Config{}},
+				provider:          "aws",
+				image:             "doitintl/secrets-init:0.4.0",
+				pullPolicy:        string(corev1.PullIfNotPresent),
+				volumeName:        binVolumeName,
+				volumePath:        binVolumePath,
+				overrideAllowlist: allowlist,
+				secretAccess:      secretAccessNone,
+			}
+			env := tt.env
+			if env == nil {
+				env = []corev1.EnvVar{{Name: "PASSWORD", Value: "gcp:secretmanager:projects/test/secrets/password"}}
+			}
+			pod := &corev1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Annotations: tt.annotations},
+				Spec: corev1.PodSpec{Containers: []corev1.Container{{
+					Name:    "app",
+					Command: []string{"echo"},
+					Env:     env,
+				}}},
+			}
+			_, err := mw.mutatePod(context.TODO(), pod, "test-ns", false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			initContainer := pod.Spec.InitContainers[0]
+			if initContainer.Image != tt.wantImage || initContainer.ImagePullPolicy != tt.wantPolicy {
+				t.Errorf("init container image = %s (%s), want %s (%s)", initContainer.Image, initContainer.ImagePullPolicy, tt.wantImage, tt.wantPolicy)
+			}
+			if initContainer.VolumeMounts[0].MountPath != tt.wantMountPath {
+				t.Errorf("init container mount path = %s, want %s", initContainer.VolumeMounts[0].MountPath, tt.wantMountPath)
+			}
+			container := pod.Spec.Containers[0]
+			if !reflect.DeepEqual(container.Command, tt.wantCommand) || !reflect.DeepEqual(container.Args, tt.wantArgs) {
+				t.Errorf("container command = %v %v, want %v %v", container.Command, container.Args, tt.wantCommand, tt.wantArgs)
+			}
+			if mw.image != "doitintl/secrets-init:0.4.0" || mw.provider != "aws" {
+				t.Errorf("mutatingWebhook settings changed: %s, %s", mw.image, mw.provider)
+			}
+		})
+	}
+}
+
+func Test_parseOverrideAllowlist(t *testing.T) {
+	got, err := parseOverrideAllowlist([]string{"image=doitintl/secrets-init:*", "image=gcr.io/*/secrets-init:*", "provider=vault"})
+	if err != nil {
+		t.Fatalf("parseOverrideAllowlist() error = %v", err)
+	}
+	want := map[string][]string{
+		"image":    {"doitintl/secrets-init:*", "gcr.io/*/secrets-init:*"},
+		"provider": {"vault"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseOverrideAllowlist() = %v, want %v", got, want)
+	}
+	for _, value := range []string{"image", "registry=*", "image=[", "=*"} {
+		if _, err = parseOverrideAllowlist([]string{value}); err == nil {
+			t.Errorf("parseOverrideAllowlist(%q) expected error", value)
+		}
+	}
+}
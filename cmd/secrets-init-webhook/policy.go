@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// policyConfigMapKey is the ConfigMap key holding reference policy document
+const policyConfigMapKey = "policy.yaml"
+
+var (
+	// ErrPolicyViolation secret reference is not allowed by namespace policy
+	ErrPolicyViolation = errors.New("secret reference not allowed by policy")
+	// ErrInvalidPolicy reference policy cannot be loaded
+	ErrInvalidPolicy = errors.New("invalid reference policy")
+)
+
+// referencePolicyConfig is the reference policy document stored in the policy ConfigMap
+//
+//	default:            # policy for namespaces not listed below; no restrictions if omitted
+//	  aws:
+//	    accounts: ["123456789012"]
+//	namespaces:
+//	  team-a:
+//	    aws:
+//	      accounts: ["123456789012"]
+//	      regions: ["us-east-1", "eu-west-1"]
+//	      ssmPathPrefixes: ["/team-a/"]
+//	    google:
+//	      projects: ["team-a-prod"]
+type referencePolicyConfig struct {
+	Default    *referencePolicy            `json:"default,omitempty"`
+	Namespaces map[string]*referencePolicy `json:"namespaces,omitempty"`
+}
+
+// referencePolicy limits secret references pods in a namespace may use;
+// omitted provider section or empty list means no restriction
+type referencePolicy struct {
+	AWS    *awsReferencePolicy    `json:"aws,omitempty"`
+	Google *googleReferencePolicy `json:"google,omitempty"`
+}
+
+type awsReferencePolicy struct {
+	Accounts        []string `json:"accounts,omitempty"`
+	Regions         []string `json:"regions,omitempty"`
+	SSMPathPrefixes []string `json:"ssmPathPrefixes,omitempty"`
+}
+
+type googleReferencePolicy struct {
+	Projects []string `json:"projects,omitempty"`
+}
+
+// policyConfigCache reference policy document parsed from a policy ConfigMap resource version
+type policyConfigCache struct {
+	mu              sync.Mutex
+	resourceVersion string
+	config          *referencePolicyConfig
+}
+
+// get returns policy document cached for ConfigMap resource version; nil if not cached
+func (c *policyConfigCache) get(configMap *corev1.ConfigMap) *referencePolicyConfig {
+	if c == nil || configMap.ResourceVersion == "" {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.resourceVersion != configMap.ResourceVersion {
+		return nil
+	}
+	return c.config
+}
+
+// put caches policy document parsed from ConfigMap resource version
+func (c *policyConfigCache) put(configMap *corev1.ConfigMap, config *referencePolicyConfig) {
+	if c == nil || configMap.ResourceVersion == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.resourceVersion = configMap.ResourceVersion
+	c.config = config
+}
+
+// parsePolicyConfigMapRef parses <namespace>/<name> policy ConfigMap reference
+func parsePolicyConfigMapRef(ref string) (ns, name string, err error) {
+	if ref == "" {
+		return "", "", nil
+	}
+	ns, name, ok := strings.Cut(ref, "/")
+	if !ok || ns == "" || name == "" || strings.Contains(name, "/") {
+		return "", "", errors.Wrapf(ErrInvalidPolicy, "policy configmap %q: expected <namespace>/<name>", ref)
+	}
+	return ns, name, nil
+}
+
+// readPolicyConfigmap reads policy ConfigMap with webhook permissions, from object cache if possible:
+// the policy is webhook configuration, pod creators (e.g. controllers) are not expected to read it
+func (mw *mutatingWebhook) readPolicyConfigmap(ctx context.Context, cmName, ns string) (*corev1.ConfigMap, error) {
+	if mw.objects != nil {
+		if configMap, ok := mw.objects.configMap(ns, cmName); ok {
+			return configMap, nil
+		}
+	}
+	configMap, err := mw.k8sClient.CoreV1().ConfigMaps(ns).Get(ctx, cmName, metav1.GetOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get configmap %s/%s", ns, cmName)
+	}
+	return configMap, nil
+}
+
+// namespacePolicy loads reference policy for the namespace; returns nil if no policy is configured
+func (mw *mutatingWebhook) namespacePolicy(ctx context.Context, ns string) (*referencePolicy, error) {
+	if mw.policyConfigMap == "" {
+		return nil, nil
+	}
+	cmNs, cmName, err := parsePolicyConfigMapRef(mw.policyConfigMap)
+	if err != nil {
+		return nil, err
+	}
+	// fail closed: pods cannot be admitted without their namespace policy
+	configMap, err := mw.readPolicyConfigmap(ctx, cmName, cmNs)
+	if err != nil {
+		if apierrors.IsNotFound(errors.Cause(err)) {
+			return nil, errors.Wrapf(ErrInvalidPolicy, "policy configmap %s/%s not found", cmNs, cmName)
+		}
+		return nil, err
+	}
+	// policy document is parsed once per ConfigMap resource version
+	config := mw.policyConfigs.get(configMap)
+	if config == nil {
+		config = &referencePolicyConfig{}
+		if err = yaml.UnmarshalStrict([]byte(configMap.Data[policyConfigMapKey]), config); err != nil {
+			return nil, errors.Wrapf(ErrInvalidPolicy, "policy configmap %s/%s key %s: %v", cmNs, cmName, policyConfigMapKey, err)
+		}
+		mw.policyConfigs.put(configMap, config)
+	}
+	if policy, ok := config.Namespaces[ns]; ok {
+		return policy, nil
+	}
+	return config.Default, nil
+}
+
+func contains(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// restricts checks policy limits any references; references the webhook cannot see are denied by such policy
+func (p *referencePolicy) restricts() bool {
+	if p == nil {
+		return false
+	}
+	aws := p.AWS != nil && (len(p.AWS.Accounts) > 0 || len(p.AWS.Regions) > 0 || len(p.AWS.SSMPathPrefixes) > 0)
+	google := p.Google != nil && len(p.Google.Projects) > 0
+	return aws || google
+}
+
+// check returns ErrPolicyViolation if the reference is not allowed by policy
+func (p *referencePolicy) check(ref *reference.SecretReference) error {
+	if p == nil {
+		return nil
+	}
+	switch ref.Provider {
+	case reference.AWS:
+		return p.AWS.check(ref)
+	case reference.Google:
+		return p.Google.check(ref)
+	case reference.HashiCorpVault, reference.Azure:
+	}
+	return nil
+}
+
+func (p *awsReferencePolicy) check(ref *reference.SecretReference) error {
+	if p == nil {
+		return nil
+	}
+	if len(p.Accounts) > 0 && !contains(p.Accounts, ref.Account) {
+		return errors.Wrapf(ErrPolicyViolation, "AWS account %q", ref.Account)
+	}
+	if len(p.Regions) > 0 && !contains(p.Regions, ref.Region) {
+		return errors.Wrapf(ErrPolicyViolation, "AWS region %q", ref.Region)
+	}
+	if len(p.SSMPathPrefixes) > 0 && ref.Service == "ssm" {
+		path := "/" + strings.TrimPrefix(ref.Name, "/")
+		for _, prefix := range p.SSMPathPrefixes {
+			if hasPathPrefix(path, prefix) {
+				return nil
+			}
+		}
+		return errors.Wrapf(ErrPolicyViolation, "SSM parameter path %q", path)
+	}
+	return nil
+}
+
+// hasPathPrefix checks path is prefix or is under it, matching whole path segments: /team-a matches /team-a and
+// /team-a/db, but not /team-ab
+func hasPathPrefix(path, prefix string) bool {
+	prefix = "/" + strings.Trim(prefix, "/")
+	return prefix == "/" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (p *googleReferencePolicy) check(ref *reference.SecretReference) error {
+	if p == nil {
+		return nil
+	}
+	// references without project use secrets-init default project: denied when projects are restricted,
+	// since the default project is not known to the webhook
+	if len(p.Projects) > 0 && !contains(p.Projects, ref.Account) {
+		return errors.Wrapf(ErrPolicyViolation, "GCP project %q", ref.Account)
+	}
+	return nil
+}
+
+// checkPolicy checks all container references against namespace policy
+func checkPolicy(policy *referencePolicy, containerName string, envVars []secretEnvVar) error {
+	for _, env := range envVars {
+		for _, ref := range env.references() {
+			if err := policy.check(ref); err != nil {
+				return errors.Wrapf(err, "container %s: env %s (from %s)", containerName, env.Name, env.Source)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	fake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+const testPolicy = `
+default:
+  aws:
+    accounts: ["000000000000"]
+namespaces:
+  team-a:
+    aws:
+      accounts: ["123456789012"]
+      regions: ["us-east-1"]
+      ssmPathPrefixes: ["/team-a/"]
+    google:
+      projects: ["team-a-prod"]
+`
+
+func Test_referencePolicy_check(t *testing.T) {
+	policy := &referencePolicy{
+		AWS: &awsReferencePolicy{
+			Accounts:        []string{"123456789012"},
+			Regions:         []string{"us-east-1"},
+			SSMPathPrefixes: []string{"team-a/"},
+		},
+		Google: &googleReferencePolicy{Projects: []string{"team-a-prod"}},
+	}
+	tests := []struct {
+		name    string
+		policy  *referencePolicy
+		value   string
+		wantErr bool
+	}{
+		{
+			name:  "no policy",
+			value: "arn:aws:secretsmanager:eu-west-1:210987654321:secret:other",
+		},
+		{
+			name:   "allowed secrets manager secret",
+			policy: policy,
+			value:  "arn:aws:secretsmanager:us-east-1:123456789012:secret:db",
+		},
+		{
+			name:    "other team account",
+			policy:  policy,
+			value:   "arn:aws:secretsmanager:us-east-1:210987654321:secret:db",
+			wantErr: true,
+		},
+		{
+			name:    "not allowed region",
+			policy:  policy,
+			value:   "arn:aws:secretsmanager:eu-west-1:123456789012:secret:db",
+			wantErr: true,
+		},
+		{
+			name:   "allowed ssm path",
+			policy: policy,
+			value:  "arn:aws:ssm:us-east-1:123456789012:parameter/team-a/db/password",
+		},
+		{
+			name:    "not allowed ssm path",
+			policy:  policy,
+			value:   "arn:aws:ssm:us-east-1:123456789012:parameter/team-b/db/password",
+			wantErr: true,
+		},
+		{
+			name:   "ssm path equal to prefix",
+			policy: policy,
+			value:  "arn:aws:ssm:us-east-1:123456789012:parameter/team-a",
+		},
+		{
+			name:    "ssm path sharing prefix without path segment",
+			policy:  policy,
+			value:   "arn:aws:ssm:us-east-1:123456789012:parameter/team-ab/db/password",
+			wantErr: true,
+		},
+		{
+			name:    "ssm path prefix without trailing slash",
+			policy:  &referencePolicy{AWS: &awsReferencePolicy{SSMPathPrefixes: []string{"/team-a"}}},
+			value:   "arn:aws:ssm:us-east-1:123456789012:parameter/team-a-old/db/password",
+			wantErr: true,
+		},
+		{
+			name:   "allowed gcp project",
+			policy: policy,
+			value:  "gcp:secretmanager:projects/team-a-prod/secrets/db",
+		},
+		{
+			name:    "not allowed gcp project",
+			policy:  policy,
+			value:   "gcp:secretmanager:projects/team-b-prod/secrets/db",
+			wantErr: true,
+		},
+		{
+			name:    "gcp reference without project",
+			policy:  policy,
+			value:   "gcp:secretmanager:db",
+			wantErr: true,
+		},
+		{
+			name:   "gcp reference without project, projects not restricted",
+			policy: &referencePolicy{Google: &googleReferencePolicy{}},
+			value:  "gcp:secretmanager:db",
+		},
+		{
+			name:   "unrestricted provider",
+			policy: policy,
+			value:  "vault:secret/data/app#password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref, err := reference.Lookup(tt.value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = tt.policy.check(ref)
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrPolicyViolation)) {
+				t.Errorf("referencePolicy.check() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_namespacePolicy(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		makeConfigMap("secrets-init", "policy", map[string]string{policyConfigMapKey: testPolicy}),
+		makeConfigMap("secrets-init", "broken", map[string]string{policyConfigMapKey: "namespaces: [team-a]"}),
+	)
+	tests := []struct {
+		name      string
+		configMap string
+		ns        string
+		want      *referencePolicy
+		wantErr   bool
+	}{
+		{
+			name: "policy disabled",
+			ns:   "team-a",
+		},
+		{
+			name:      "namespace policy",
+			configMap: "secrets-init/policy",
+			ns:        "team-a",
+			want: &referencePolicy{
+				AWS: &awsReferencePolicy{
+					Accounts:        []string{"123456789012"},
+					Regions:         []string{"us-east-1"},
+					SSMPathPrefixes: []string{"/team-a/"},
+				},
+				Google: &googleReferencePolicy{Projects: []string{"team-a-prod"}},
+			},
+		},
+		{
+			name:      "default policy",
+			configMap: "secrets-init/policy",
+			ns:        "team-b",
+			want:      &referencePolicy{AWS: &awsReferencePolicy{Accounts: []string{"000000000000"}}},
+		},
+		{
+			name:      "missing policy configmap",
+			configMap: "secrets-init/missing",
+			ns:        "team-a",
+			wantErr:   true,
+		},
+		{
+			name:      "malformed policy",
+			configMap: "secrets-init/broken",
+			ns:        "team-a",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{k8sClient: client, policyConfigMap: tt.configMap}
+			got, err := mw.namespacePolicy(context.TODO(), tt.ns)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mutatingWebhook.namespacePolicy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mutatingWebhook.namespacePolicy() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_namespacePolicy_resourceVersion(t *testing.T) {
+	configMap := makeConfigMap("secrets-init", "policy", map[string]string{policyConfigMapKey: testPolicy})
+	configMap.ResourceVersion = "1"
+	client := fake.NewSimpleClientset(configMap)
+	mw := &mutatingWebhook{k8sClient: client, policyConfigMap: "secrets-init/policy", policyConfigs: &policyConfigCache{}}
+	first, err := mw.namespacePolicy(context.TODO(), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := mw.namespacePolicy(context.TODO(), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Errorf("mutatingWebhook.namespacePolicy() parsed policy again for the same resource version")
+	}
+	// changed policy is parsed again
+	configMap = configMap.DeepCopy()
+	configMap.ResourceVersion = "2"
+	configMap.Data[policyConfigMapKey] = "namespaces:\n  team-a: {}\n"
+	if _, err = client.CoreV1().ConfigMaps("secrets-init").Update(context.TODO(), configMap, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := mw.namespacePolicy(context.TODO(), "team-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (&referencePolicy{}); !reflect.DeepEqual(got, want) {
+		t.Errorf("mutatingWebhook.namespacePolicy() = %+v, want %+v", got, want)
+	}
+}
+
+func Test_mutatingWebhook_mutateContainers_policy(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient: fake.NewSimpleClientset(
+			makeConfigMap("secrets-init", "policy", map[string]string{policyConfigMapKey: testPolicy}),
+		),
+		registry:        &MockRegistry{Image: v1.Config{}},
+		provider:        "aws",
+		volumeName:      binVolumeName,
+		volumePath:      binVolumePath,
+		policyConfigMap: "secrets-init/policy",
+	}
+	containers := []corev1.Container{
+		{
+			Name:    "TestContainer",
+			Image:   "test-image",
+			Command: []string{"echo"},
+			Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: "arn:aws:secretsmanager:us-east-1:210987654321:secret:db"}},
+		},
+	}
+	_, _, err := mw.mutateContainers(context.TODO(), containers, &corev1.Pod{}, "team-a")
+	if !errors.Is(err, ErrPolicyViolation) {
+		t.Errorf("mutatingWebhook.mutateContainers() error = %v, want %v", err, ErrPolicyViolation)
+	}
+}
+
+func Test_mutatingWebhook_mutateContainers_policyWithObjectAccess(t *testing.T) {
+	controller := &authenticationv1.UserInfo{Username: "system:serviceaccount:kube-system:replicaset-controller"}
+	for _, objectAccess := range []string{objectAccessImpersonate, objectAccessSubjectAccessReview} {
+		t.Run(objectAccess, func(t *testing.T) {
+			client := fake.NewSimpleClientset(
+				makeConfigMap("secrets-init", "policy", map[string]string{policyConfigMapKey: testPolicy}),
+			)
+			// pod creator cannot read the policy ConfigMap
+			client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, action.(k8stesting.CreateAction).GetObject(), nil
+			})
+			userClient := fake.NewSimpleClientset()
+			userClient.PrependReactor("get", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				return true, nil, apierrors.NewForbidden(corev1.Resource("configmaps"), "policy", nil)
+			})
+			mw := &mutatingWebhook{
+				k8sClient:       client,
+				registry:        &MockRegistry{Image: v1.Config{}},
+				provider:        "aws",
+				volumeName:      binVolumeName,
+				volumePath:      binVolumePath,
+				policyConfigMap: "secrets-init/policy",
+				objectAccess:    objectAccess,
+				impersonate: func(*authenticationv1.UserInfo) (kubernetes.Interface, error) {
+					return userClient, nil
+				},
+			}
+			ctx := withAdmissionUser(context.TODO(), controller)
+			tests := []struct {
+				value   string
+				wantErr error
+			}{
+				{value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:db"},
+				{value: "arn:aws:secretsmanager:us-east-1:210987654321:secret:db", wantErr: ErrPolicyViolation},
+			}
+			for _, tt := range tests {
+				containers := []corev1.Container{
+					{
+						Name:    "TestContainer",
+						Image:   "test-image",
+						Command: []string{"echo"},
+						Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: tt.value}},
+					},
+				}
+				_, _, err := mw.mutateContainers(withAdmissionObjects(ctx), containers, &corev1.Pod{}, "team-a")
+				if (tt.wantErr == nil && err != nil) || (tt.wantErr != nil && !errors.Is(err, tt.wantErr)) {
+					t.Errorf("mutatingWebhook.mutateContainers(%s) error = %v, want %v", tt.value, err, tt.wantErr)
+				}
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_mutateContainers_policyHiddenEnv(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		makeConfigMap("secrets-init", "policy", map[string]string{policyConfigMapKey: testPolicy + "  team-b: {}\n"}),
+	)
+	secretKeyRef := corev1.EnvVar{Name: "PASSWORD", ValueFrom: &corev1.EnvVarSource{SecretKeyRef: &corev1.SecretKeySelector{
+		LocalObjectReference: corev1.LocalObjectReference{Name: "test-secret"}, Key: "password"}}}
+	injectPod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{injectAnnotation: "true"}}}
+	tests := []struct {
+		name      string
+		configMap string
+		ns        string
+		wantErr   error
+	}{
+		{name: "no policy", ns: "team-a"},
+		{name: "restricting namespace policy", configMap: "secrets-init/policy", ns: "team-a", wantErr: ErrPolicyViolation},
+		{name: "restricting default policy", configMap: "secrets-init/policy", ns: "team-c", wantErr: ErrPolicyViolation},
+		{name: "namespace policy without restrictions", configMap: "secrets-init/policy", ns: "team-b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:       client,
+				registry:        &MockRegistry{Image: v1.Config{}},
+				provider:        "aws",
+				volumeName:      binVolumeName,
+				volumePath:      binVolumePath,
+				policyConfigMap: tt.configMap,
+				secretAccess:    secretAccessNone,
+			}
+			// references kept in Secrets the webhook does not read cannot be checked against policy
+			containers := []corev1.Container{{Name: "app", Command: []string{"echo"}, Env: []corev1.EnvVar{secretKeyRef}}}
+			mutated, _, err := mw.mutateContainers(context.TODO(), containers, injectPod, tt.ns)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("mutatingWebhook.mutateContainers() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || !mutated {
+				t.Errorf("mutatingWebhook.mutateContainers() = %v, %v, want mutated", mutated, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/pod-security-admission/api"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// injectionPreinstalled secrets-init binary is pre-installed on nodes and mounted with hostPath or CSI volume
+	injectionPreinstalled = "preinstalled"
+
+	preinstalledHostPath = "hostPath"
+	preinstalledCSI      = "csi"
+)
+
+var (
+	// ErrInvalidPreinstalledVolume preinstalled volume source is not a hostPath or CSI volume source
+	ErrInvalidPreinstalledVolume = errors.New("invalid preinstalled volume")
+	// ErrPreinstalledVolumeNotAllowed preinstalled volume source does not match allowlist
+	ErrPreinstalledVolumeNotAllowed = errors.New("preinstalled volume is not allowed")
+)
+
+// preinstalledVolumeRule allows hostPath volumes with matching path or CSI volumes with matching driver
+type preinstalledVolumeRule struct {
+	kind    string
+	pattern string
+}
+
+// parsePreinstalledVolumeAllowlist parses hostPath=<path pattern> and csi=<driver pattern> values
+func parsePreinstalledVolumeAllowlist(values []string) ([]preinstalledVolumeRule, error) {
+	var rules []preinstalledVolumeRule
+	for _, value := range values {
+		kind, pattern, ok := strings.Cut(value, "=")
+		if !ok || (kind != preinstalledHostPath && kind != preinstalledCSI) || pattern == "" {
+			return nil, errors.Wrapf(ErrInvalidPreinstalledVolume, "expected hostPath=<path pattern> or csi=<driver pattern>, got %q", value)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(ErrInvalidPreinstalledVolume, "%q: %v", value, err)
+		}
+		rules = append(rules, preinstalledVolumeRule{kind: kind, pattern: pattern})
+	}
+	return rules, nil
+}
+
+// parsePreinstalledVolume parses YAML or JSON volume source with either hostPath or csi set; nil if empty
+func parsePreinstalledVolume(data string) (*corev1.VolumeSource, error) {
+	if data == "" {
+		return nil, nil
+	}
+	var source corev1.VolumeSource
+	if err := yaml.UnmarshalStrict([]byte(data), &source); err != nil {
+		return nil, errors.Wrap(ErrInvalidPreinstalledVolume, err.Error())
+	}
+	if !isPreinstalledVolume(&source) {
+		return nil, errors.Wrapf(ErrInvalidPreinstalledVolume, "expected either hostPath or csi volume source, got %q", data)
+	}
+	return &source, nil
+}
+
+// isPreinstalledVolume checks volume source is a hostPath or CSI volume source only
+func isPreinstalledVolume(source *corev1.VolumeSource) bool {
+	if (source.HostPath == nil) == (source.CSI == nil) {
+		return false
+	}
+	return reflect.DeepEqual(*source, corev1.VolumeSource{HostPath: source.HostPath, CSI: source.CSI})
+}
+
+// preinstalledVolumeAllowed checks volume source against allowlist; hostPath volumes must be existing directories
+// (type Directory: without type, kubelet mounts any file type unchecked), without path elements that could escape
+// the allowed path
+func preinstalledVolumeAllowed(source *corev1.VolumeSource, allowlist []preinstalledVolumeRule) bool {
+	var kind, value string
+	switch {
+	case !isPreinstalledVolume(source):
+		return false
+	case source.HostPath != nil:
+		if source.HostPath.Type == nil || *source.HostPath.Type != corev1.HostPathDirectory {
+			return false
+		}
+		if path.Clean(source.HostPath.Path) != source.HostPath.Path {
+			return false
+		}
+		kind, value = preinstalledHostPath, source.HostPath.Path
+	default:
+		kind, value = preinstalledCSI, source.CSI.Driver
+	}
+	for _, rule := range allowlist {
+		if matched, _ := path.Match(rule.pattern, value); matched && rule.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// volumeSourceName describes volume source in errors
+func volumeSourceName(source *corev1.VolumeSource) string {
+	switch {
+	case source.HostPath != nil:
+		return fmt.Sprintf("hostPath %s", source.HostPath.Path)
+	case source.CSI != nil:
+		return fmt.Sprintf("csi driver %s", source.CSI.Driver)
+	}
+	return "volume source"
+}
+
+// injectPreinstalledVolume adds preinstalled secrets-init volume, unless pod already has it; volume source of
+// existing volume must be allowed too
+func (mw *mutatingWebhook) injectPreinstalledVolume(pod *corev1.Pod, level api.LevelVersion) error {
+	if v := podVolume(pod, mw.volumeName); v != nil {
+		if !preinstalledVolumeAllowed(&v.VolumeSource, mw.preinstalledVolumeAllowlist) {
+			return errors.Wrapf(ErrPreinstalledVolumeNotAllowed, "volume %s: %s", v.Name, volumeSourceName(&v.VolumeSource))
+		}
+		logger.WithField("pod", pod.Name).Debug("pod already has preinstalled secrets-init volume")
+		return nil
+	}
+	if mw.preinstalledVolume == nil {
+		return errors.Wrap(ErrInvalidPreinstalledVolume, "preinstalled volume is not configured")
+	}
+	if mw.preinstalledVolume.HostPath != nil && level.Level != api.LevelPrivileged {
+		return errors.Wrapf(ErrPodSecurity, "namespace enforces %q level, preinstalled secrets-init hostPath volume is not allowed", level)
+	}
+	pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{Name: mw.volumeName, VolumeSource: *mw.preinstalledVolume.DeepCopy()})
+	logger.Debug("successfully appended pod spec preinstalled volume")
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/pod-security-admission/api"
+)
+
+func Test_parsePreinstalledVolume(t *testing.T) {
+	readOnly := true
+	tests := []struct {
+		name    string
+		data    string
+		want    *corev1.VolumeSource
+		wantErr bool
+	}{
+		{
+			name: "not set",
+		},
+		{
+			name: "hostPath YAML",
+			data: "hostPath:\n  path: /opt/secrets-init\n",
+			want: &corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/opt/secrets-init"}},
+		},
+		{
+			name: "csi JSON",
+			data: `{"csi": {"driver": "secrets-init.csi.example.com", "readOnly": true}}`,
+			want: &corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-init.csi.example.com", ReadOnly: &readOnly}},
+		},
+		{
+			name:    "other volume source",
+			data:    "emptyDir: {}\n",
+			wantErr: true,
+		},
+		{
+			name:    "hostPath and csi",
+			data:    "hostPath:\n  path: /opt/secrets-init\ncsi:\n  driver: secrets-init.csi.example.com\n",
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			data:    "hostPath:\n  dir: /opt/secrets-init\n",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parsePreinstalledVolume(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePreinstalledVolume() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parsePreinstalledVolume() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_preinstalledVolumeAllowed(t *testing.T) {
+	allowlist, err := parsePreinstalledVolumeAllowlist([]string{"hostPath=/opt/secrets-init/*", "csi=*.csi.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostPath := func(path string, pathType corev1.HostPathType) *corev1.VolumeSource {
+		return &corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path, Type: &pathType}}
+	}
+	tests := []struct {
+		name   string
+		source *corev1.VolumeSource
+		want   bool
+	}{
+		{name: "allowed hostPath directory", source: hostPath("/opt/secrets-init/v0.5", corev1.HostPathDirectory), want: true},
+		{name: "hostPath with empty type", source: hostPath("/opt/secrets-init/v0.5", "")},
+		{name: "hostPath without type", source: &corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/opt/secrets-init/v0.5"}}},
+		{name: "hostPath created on node", source: hostPath("/opt/secrets-init/v0.5", corev1.HostPathDirectoryOrCreate)},
+		{name: "hostPath escaping allowed path", source: hostPath("/opt/secrets-init/../../etc", corev1.HostPathDirectory)},
+		{name: "other hostPath", source: hostPath("/usr/bin", corev1.HostPathDirectory)},
+		{name: "allowed csi driver", source: &corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-init.csi.example.com"}}, want: true},
+		{name: "other csi driver", source: &corev1.VolumeSource{CSI: &corev1.CSIVolumeSource{Driver: "secrets-store.csi.k8s.io"}}},
+		{name: "emptyDir", source: &corev1.VolumeSource{EmptyDir: &corev1.EmptyDirVolumeSource{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := preinstalledVolumeAllowed(tt.source, allowlist); got != tt.want {
+				t.Errorf("preinstalledVolumeAllowed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_parsePreinstalledVolumeAllowlist(t *testing.T) {
+	for _, value := range []string{"hostPath", "emptyDir=*", "hostPath=", "csi=[driver"} {
+		if _, err := parsePreinstalledVolumeAllowlist([]string{value}); !errors.Is(err, ErrInvalidPreinstalledVolume) {
+			t.Errorf("parsePreinstalledVolumeAllowlist(%q) error = %v, want %v", value, err, ErrInvalidPreinstalledVolume)
+		}
+	}
+}
+
+// helper function - hostPath volume source of existing node directory
+func directoryVolume(path string) *corev1.VolumeSource {
+	pathType := corev1.HostPathDirectory
+	return &corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: path, Type: &pathType}}
+}
+
+func Test_mutatingWebhook_mutatePod_preinstalled(t *testing.T) {
+	allowlist := []preinstalledVolumeRule{{kind: preinstalledHostPath, pattern: "/opt/secrets-init"}}
+	preinstalled := directoryVolume("/opt/secrets-init")
+	tests := []struct {
+		name    string
+		level   api.Level
+		volume  *corev1.VolumeSource
+		wantErr error
+	}{
+		{
+			name: "preinstalled volume",
+		},
+		{
+			name:   "pod preinstalled volume",
+			volume: directoryVolume("/opt/secrets-init"),
+		},
+		{
+			name:    "pod preinstalled volume not allowed",
+			volume:  directoryVolume("/tmp"),
+			wantErr: ErrPreinstalledVolumeNotAllowed,
+		},
+		{
+			name:    "pod preinstalled volume without hostPath type",
+			volume:  &corev1.VolumeSource{HostPath: &corev1.HostPathVolumeSource{Path: "/opt/secrets-init"}},
+			wantErr: ErrPreinstalledVolumeNotAllowed,
+		},
+		{
+			name:    "hostPath volume in baseline namespace",
+			level:   api.LevelBaseline,
+			wantErr: ErrPodSecurity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-ns"}}
+			if tt.level != "" {
+				namespace.Labels = map[string]string{api.EnforceLevelLabel: string(tt.level)}
+			}
+			mw := &mutatingWebhook{
+				k8sClient:                   fake.NewSimpleClientset(namespace),
+				registry:                    &MockRegistry{Image: v1.Config{}},
+				provider:                    "aws",
+				image:                       secretsInitImage,
+				volumeName:                  binVolumeName,
+				volumePath:                  binVolumePath,
+				injectionMode:               injectionPreinstalled,
+				preinstalledVolume:          preinstalled,
+				preinstalledVolumeAllowlist: allowlist,
+			}
+			pod := makeTestPod()
+			if tt.volume != nil {
+				// pod brings its own secrets-init volume in server copy mode
+				mw.injectionMode = injectionCopy
+				pod.Spec.Volumes = []corev1.Volume{{Name: binVolumeName, VolumeSource: *tt.volume}}
+			}
+			_, err := mw.mutatePod(context.TODO(), pod, "test-ns", false)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("mutatingWebhook.mutatePod() error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+			}
+			// reinvoked webhook keeps pod unchanged
+			want := pod.DeepCopy()
+			if _, err = mw.mutatePod(context.TODO(), pod, "test-ns", false); err != nil {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v", err)
+			}
+			if !reflect.DeepEqual(pod, want) {
+				t.Errorf("reinvoked mutatingWebhook.mutatePod() = %+v, want %+v", pod, want)
+			}
+
+			if hasContainer(pod.Spec.InitContainers, secretsInitContainerName) {
+				t.Errorf("init containers = %+v, want no %s", pod.Spec.InitContainers, secretsInitContainerName)
+			}
+			wantVolumes := []corev1.Volume{{Name: binVolumeName, VolumeSource: *preinstalled}}
+			if !reflect.DeepEqual(pod.Spec.Volumes, wantVolumes) {
+				t.Errorf("volumes = %+v, want %+v", pod.Spec.Volumes, wantVolumes)
+			}
+			wantMount := corev1.VolumeMount{Name: binVolumeName, MountPath: binVolumePath, ReadOnly: true}
+			app := pod.Spec.Containers[0]
+			if !reflect.DeepEqual(app.VolumeMounts, []corev1.VolumeMount{wantMount}) {
+				t.Errorf("volume mounts = %+v, want %+v", app.VolumeMounts, wantMount)
+			}
+			if want := []string{binVolumePath + "/secrets-init"}; !reflect.DeepEqual(app.Command, want) {
+				t.Errorf("command = %v, want %v", app.Command, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// annotationPrefix is the common prefix of pod annotations used to configure secrets-init
+	annotationPrefix = "secrets-init.doit-intl.com/"
+
+	// vaultAddrAnnotation Vault server address, e.g. https://vault.example.com:8200
+	vaultAddrAnnotation = annotationPrefix + "vault-addr"
+	// vaultRoleAnnotation Vault Kubernetes auth role to log in with
+	vaultRoleAnnotation = annotationPrefix + "vault-role"
+	// vaultAuthPathAnnotation Vault Kubernetes auth method mount path (default: kubernetes)
+	vaultAuthPathAnnotation = annotationPrefix + "vault-auth-path"
+
+	// azureClientIDAnnotation Azure Workload Identity ServiceAccount annotation with the managed identity client ID
+	azureClientIDAnnotation = "azure.workload.identity/client-id"
+
+	// defaultServiceAccount is the ServiceAccount used by a pod that does not specify one
+	defaultServiceAccount = "default"
+)
+
+var (
+	// ErrInvalidAnnotation pod annotation has invalid value
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+	// ErrUnsupportedProvider unknown secrets manager provider
+	ErrUnsupportedProvider = errors.New("unsupported secrets manager provider")
+)
+
+// isSupportedProvider checks provider is one of supported secrets manager providers
+func isSupportedProvider(provider string) bool {
+	for _, p := range reference.Providers {
+		if string(p) == provider {
+			return true
+		}
+	}
+	return false
+}
+
+// providerArgs returns secrets-init arguments for the selected provider
+func (mw *mutatingWebhook) providerArgs(ctx context.Context, provider string, pod *corev1.Pod, ns string) ([]string, error) {
+	args := []string{fmt.Sprintf("--provider=%s", provider)}
+	switch reference.Provider(provider) {
+	case reference.HashiCorpVault:
+		vault, err := vaultArgs(pod.Annotations)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, vault...)
+	case reference.Azure:
+		azure, err := mw.azureArgs(ctx, pod, ns)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, azure...)
+	case reference.AWS, reference.Google:
+	}
+	return args, nil
+}
+
+// azureArgs returns secrets-init Azure Workload Identity arguments from the pod ServiceAccount annotation
+func (mw *mutatingWebhook) azureArgs(ctx context.Context, pod *corev1.Pod, ns string) ([]string, error) {
+	saName := pod.Spec.ServiceAccountName
+	if saName == "" {
+		saName = defaultServiceAccount
+	}
+	annotations, err := mw.getServiceAccountAnnotations(ctx, saName, ns)
+	if err != nil {
+		return nil, err
+	}
+	clientID, ok := annotations[azureClientIDAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("--azure-client-id=%s", clientID)}, nil
+}
+
+// vaultArgs returns secrets-init Vault login arguments from pod annotations;
+// secrets-init logs in with the pod ServiceAccount token using Vault Kubernetes auth method
+func vaultArgs(annotations map[string]string) ([]string, error) {
+	var args []string
+	if addr, ok := annotations[vaultAddrAnnotation]; ok {
+		u, err := url.Parse(addr)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, errors.Wrapf(ErrInvalidAnnotation, "%s: %q is not a valid Vault address", vaultAddrAnnotation, addr)
+		}
+		args = append(args, fmt.Sprintf("--vault-addr=%s", addr))
+	}
+	if role, ok := annotations[vaultRoleAnnotation]; ok {
+		if role == "" {
+			return nil, errors.Wrapf(ErrInvalidAnnotation, "%s: empty Vault role", vaultRoleAnnotation)
+		}
+		args = append(args, fmt.Sprintf("--vault-role=%s", role))
+	}
+	if authPath, ok := annotations[vaultAuthPathAnnotation]; ok {
+		authPath = strings.Trim(authPath, "/")
+		if authPath == "" {
+			return nil, errors.Wrapf(ErrInvalidAnnotation, "%s: empty Vault auth path", vaultAuthPathAnnotation)
+		}
+		args = append(args, fmt.Sprintf("--vault-auth-path=%s", authPath))
+	}
+	return args, nil
+}
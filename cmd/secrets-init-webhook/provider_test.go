@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	fake "k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_mutatingWebhook_mutateContainers_vault(t *testing.T) {
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{
+				vaultAddrAnnotation:     "https://vault.example.com:8200",
+				vaultRoleAnnotation:     "app",
+				vaultAuthPathAnnotation: "k8s-dev",
+			},
+		},
+	}
+	containers := []corev1.Container{
+		{
+			Name:    "TestContainer",
+			Image:   "test-image",
+			Command: []string{"echo"},
+			Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: "vault:secret/data/app#password"}},
+		},
+	}
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+
+	mutated, _, err := mw.mutateContainers(context.TODO(), containers, pod, "test-ns")
+	if err != nil || !mutated {
+		t.Fatalf("mutatingWebhook.mutateContainers() = %v, %v", mutated, err)
+	}
+	wantArgs := []string{
+		"--provider=vault",
+		"--vault-addr=https://vault.example.com:8200",
+		"--vault-role=app",
+		"--vault-auth-path=k8s-dev",
+		"echo",
+	}
+	if !reflect.DeepEqual(containers[0].Args, wantArgs) {
+		t.Errorf("container args = %v, want %v", containers[0].Args, wantArgs)
+	}
+}
+
+func Test_vaultArgs(t *testing.T) {
+	tests := []struct {
+		name        string
+		annotations map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name: "no annotations",
+		},
+		{
+			name:        "invalid address",
+			annotations: map[string]string{vaultAddrAnnotation: "vault.example.com"},
+			wantErr:     true,
+		},
+		{
+			name:        "empty role",
+			annotations: map[string]string{vaultRoleAnnotation: ""},
+			wantErr:     true,
+		},
+		{
+			name:        "role only",
+			annotations: map[string]string{vaultRoleAnnotation: "app"},
+			want:        []string{"--vault-role=app"},
+		},
+		{
+			name: "all annotations",
+			annotations: map[string]string{
+				vaultAddrAnnotation:     "http://vault.vault.svc:8200",
+				vaultRoleAnnotation:     "app",
+				vaultAuthPathAnnotation: "kubernetes",
+			},
+			want: []string{"--vault-addr=http://vault.vault.svc:8200", "--vault-role=app", "--vault-auth-path=kubernetes"},
+		},
+		{
+			name:        "address without host",
+			annotations: map[string]string{vaultAddrAnnotation: "https://"},
+			wantErr:     true,
+		},
+		{
+			name:        "unsupported address scheme",
+			annotations: map[string]string{vaultAddrAnnotation: "ftp://vault.example.com"},
+			wantErr:     true,
+		},
+		{
+			name:        "auth path slashes trimmed",
+			annotations: map[string]string{vaultAuthPathAnnotation: "/k8s-dev/"},
+			want:        []string{"--vault-auth-path=k8s-dev"},
+		},
+		{
+			name:        "empty auth path",
+			annotations: map[string]string{vaultAuthPathAnnotation: "/"},
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := vaultArgs(tt.annotations)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("vaultArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("vaultArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_providerArgs(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		pod      *corev1.Pod
+		objects  []runtime.Object
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "aws",
+			provider: "aws",
+			pod:      &corev1.Pod{},
+			want:     []string{"--provider=aws"},
+		},
+		{
+			name:     "azure with workload identity client id",
+			provider: "azure",
+			pod:      &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: "app"}},
+			objects: []runtime.Object{&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        "app",
+					Namespace:   "test-ns",
+					Annotations: map[string]string{azureClientIDAnnotation: "00000000-0000-0000-0000-000000000000"},
+				},
+			}},
+			want: []string{"--provider=azure", "--azure-client-id=00000000-0000-0000-0000-000000000000"},
+		},
+		{
+			name:     "azure with default service account without annotation",
+			provider: "azure",
+			pod:      &corev1.Pod{},
+			objects: []runtime.Object{&corev1.ServiceAccount{
+				ObjectMeta: metav1.ObjectMeta{Name: defaultServiceAccount, Namespace: "test-ns"},
+			}},
+			want: []string{"--provider=azure"},
+		},
+		{
+			name:     "azure with missing service account",
+			provider: "azure",
+			pod:      &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: "app"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{k8sClient: fake.NewSimpleClientset(tt.objects...)}
+			got, err := mw.providerArgs(context.TODO(), tt.provider, tt.pod, "test-ns")
+			if (err != nil) != tt.wantErr {
+				t.Errorf("mutatingWebhook.providerArgs() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mutatingWebhook.providerArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_mutateContainers_azureServiceAccountOnce(t *testing.T) {
+	client := fake.NewSimpleClientset(&corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "app",
+			Namespace:   "test-ns",
+			Annotations: map[string]string{azureClientIDAnnotation: "00000000-0000-0000-0000-000000000000"},
+		},
+	})
+	pod := &corev1.Pod{Spec: corev1.PodSpec{ServiceAccountName: "app"}}
+	container := func(name string) corev1.Container {
+		return corev1.Container{
+			Name:    name,
+			Image:   "test-image",
+			Command: []string{"echo"},
+			Env:     []corev1.EnvVar{{Name: "PASSWORD", Value: "azure:keyvault:my-vault/db-password"}},
+		}
+	}
+	containers := []corev1.Container{container("app"), container("worker")}
+	mw := &mutatingWebhook{
+		k8sClient:  client,
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+
+	mutated, _, err := mw.mutateContainers(withAdmissionObjects(context.TODO()), containers, pod, "test-ns")
+	if err != nil || !mutated {
+		t.Fatalf("mutatingWebhook.mutateContainers() = %v, %v", mutated, err)
+	}
+	for _, c := range containers {
+		if want := "--azure-client-id=00000000-0000-0000-0000-000000000000"; len(c.Args) < 2 || c.Args[1] != want {
+			t.Errorf("container %s args = %v, want %s", c.Name, c.Args, want)
+		}
+	}
+	if gets := countGets(client, "serviceaccounts"); gets != 1 {
+		t.Errorf("mutatingWebhook.mutateContainers() service account GETs = %d, want 1", gets)
+	}
+}
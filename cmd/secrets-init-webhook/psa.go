@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/pod-security-admission/api"
+	"k8s.io/pod-security-admission/policy"
+)
+
+const (
+	// namespaceLevelTTL how long Pod Security Standards level of a namespace is cached
+	namespaceLevelTTL = 30 * time.Second
+	// namespaceLevelCacheSize max number of namespaces with cached Pod Security Standards level
+	namespaceLevelCacheSize = 1024
+
+	// helperRunAsUser non-root user (nobody) secrets-init init container runs as in restricted namespaces
+	helperRunAsUser int64 = 65534
+	capabilityAll         = "ALL"
+
+	// helperRunAsUserName non-administrator user secrets-init init container of Windows pods runs as in restricted namespaces
+	helperRunAsUserName = "ContainerUser"
+)
+
+// ErrPodSecurity pod violates Pod Security Standards level enforced in its namespace
+var ErrPodSecurity = errors.New("pod violates enforced Pod Security Standards")
+
+// podSecurityEvaluator Pod Security Standards checks of Pod Security Admission, for all supported policy versions
+var podSecurityEvaluator = newPodSecurityEvaluator()
+
+func newPodSecurityEvaluator() policy.Evaluator {
+	evaluator, err := policy.NewEvaluator(policy.DefaultChecks())
+	if err != nil {
+		// default checks are always valid
+		panic(err)
+	}
+	return evaluator
+}
+
+// podSecurityLevel returns Pod Security Standards level and version enforced in the namespace; privileged if not
+// known. Namespace levels are cached for namespaceLevelTTL
+func (mw *mutatingWebhook) podSecurityLevel(ctx context.Context, ns string) api.LevelVersion {
+	if mw.namespaceLevels != nil {
+		if level, ok := mw.namespaceLevels.Get(ns); ok {
+			return level.(api.LevelVersion)
+		}
+	}
+	privileged := api.LevelVersion{Level: api.LevelPrivileged, Version: api.LatestVersion()}
+	namespace, err := mw.k8sClient.CoreV1().Namespaces().Get(ctx, ns, metav1.GetOptions{})
+	if err != nil {
+		// fail open: without namespace labels the pod is mutated as before
+		logger.WithError(err).WithField("namespace", ns).Warn("failed to get namespace Pod Security level")
+		return privileged
+	}
+	// invalid labels are evaluated as restricted level, like Pod Security Admission does
+	policy, errs := api.PolicyToEvaluate(namespace.Labels, api.Policy{Enforce: privileged})
+	if len(errs) > 0 {
+		logger.WithError(errs.ToAggregate()).WithField("namespace", ns).Warn("invalid namespace Pod Security labels")
+	}
+	if mw.namespaceLevels != nil {
+		mw.namespaceLevels.Add(ns, policy.Enforce, namespaceLevelTTL)
+	}
+	return policy.Enforce
+}
+
+// podSecurityViolations evaluates pod against Pod Security Standards level, ignoring violations it shares with
+// baseline pod spec if set; empty if pod is allowed
+func podSecurityViolations(level api.LevelVersion, meta *metav1.ObjectMeta, spec, baseline *corev1.PodSpec) string {
+	var known []policy.CheckResult
+	if baseline != nil {
+		known = podSecurityEvaluator.EvaluatePod(level, meta, baseline)
+	}
+	var results []policy.CheckResult
+	for _, result := range podSecurityEvaluator.EvaluatePod(level, meta, spec) {
+		if !result.Allowed && !containsCheckResult(known, result) {
+			results = append(results, result)
+		}
+	}
+	if aggregate := policy.AggregateCheckResults(results); !aggregate.Allowed {
+		return aggregate.ForbiddenDetail()
+	}
+	return ""
+}
+
+func containsCheckResult(results []policy.CheckResult, result policy.CheckResult) bool {
+	for _, r := range results {
+		if r == result {
+			return true
+		}
+	}
+	return false
+}
+
+// checkPodSecurity checks pod that cannot pass Pod Security Standards level regardless of mutation;
+// secrets-init init container is checked separately
+func checkPodSecurity(pod *corev1.Pod, level api.LevelVersion) error {
+	if level.Level == api.LevelPrivileged {
+		return nil
+	}
+	spec := pod.Spec.DeepCopy()
+	if index := containerIndex(spec.InitContainers, secretsInitContainerName); index >= 0 {
+		spec.InitContainers = append(spec.InitContainers[:index], spec.InitContainers[index+1:]...)
+	}
+	if violations := podSecurityViolations(level, &pod.ObjectMeta, spec, nil); violations != "" {
+		return errors.Wrapf(ErrPodSecurity, "namespace enforces %q level, pod %s would be rejected regardless of secrets-init: %s",
+			level, pod.Name, violations)
+	}
+	return nil
+}
+
+// isWindowsPod checks pod sets spec.os.name to windows; Pod Security Standards skip Linux-only checks for such pods
+func isWindowsPod(spec *corev1.PodSpec) bool {
+	return spec.OS != nil && spec.OS.Name == corev1.Windows
+}
+
+func containsCapability(capabilities []corev1.Capability, capability corev1.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// secureHelper sets secrets-init init container security context fields, left unset by the container template and pod,
+// to pass Pod Security Standards level; fails if the template conflicts with the level. Windows pods reject Linux-only
+// fields, their secrets-init init container runs as a non-administrator user instead
+func secureHelper(container *corev1.Container, spec *corev1.PodSpec, level api.LevelVersion) error {
+	if level.Level == api.LevelPrivileged {
+		return nil
+	}
+	if level.Level == api.LevelRestricted {
+		podSC := spec.SecurityContext
+		if podSC == nil {
+			podSC = &corev1.PodSecurityContext{}
+		}
+		if container.SecurityContext == nil {
+			container.SecurityContext = &corev1.SecurityContext{}
+		}
+		sc := container.SecurityContext
+		if sc.RunAsNonRoot == nil && podSC.RunAsNonRoot == nil {
+			runAsNonRoot := true
+			sc.RunAsNonRoot = &runAsNonRoot
+		}
+		if isWindowsPod(spec) {
+			secureWindowsHelper(sc, podSC)
+		} else {
+			secureLinuxHelper(sc, podSC)
+		}
+	}
+	// evaluate secrets-init init container alone, with pod-level fields it inherits; pod-level violations are
+	// reported by checkPodSecurity
+	podSpec := &corev1.PodSpec{OS: spec.OS, SecurityContext: spec.SecurityContext}
+	helperSpec := podSpec.DeepCopy()
+	helperSpec.InitContainers = []corev1.Container{*container}
+	if violations := podSecurityViolations(level, &metav1.ObjectMeta{}, helperSpec, podSpec); violations != "" {
+		return errors.Wrapf(ErrPodSecurity, "namespace enforces %q level, check secrets-init helper template: %s", level, violations)
+	}
+	return nil
+}
+
+func secureLinuxHelper(sc *corev1.SecurityContext, podSC *corev1.PodSecurityContext) {
+	if sc.AllowPrivilegeEscalation == nil {
+		sc.AllowPrivilegeEscalation = new(bool)
+	}
+	if sc.Capabilities == nil {
+		sc.Capabilities = &corev1.Capabilities{}
+	}
+	if !containsCapability(sc.Capabilities.Drop, capabilityAll) {
+		sc.Capabilities.Drop = append(sc.Capabilities.Drop, capabilityAll)
+	}
+	// secrets-init image runs as root: kubelet refuses to start it with runAsNonRoot and no user
+	if sc.RunAsUser == nil && podSC.RunAsUser == nil {
+		runAsUser := helperRunAsUser
+		sc.RunAsUser = &runAsUser
+	}
+	if sc.SeccompProfile == nil && podSC.SeccompProfile == nil {
+		sc.SeccompProfile = &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}
+	}
+}
+
+func secureWindowsHelper(sc *corev1.SecurityContext, podSC *corev1.PodSecurityContext) {
+	// kubelet refuses to start ContainerAdministrator with runAsNonRoot
+	if (sc.WindowsOptions == nil || sc.WindowsOptions.RunAsUserName == nil) &&
+		(podSC.WindowsOptions == nil || podSC.WindowsOptions.RunAsUserName == nil) {
+		if sc.WindowsOptions == nil {
+			sc.WindowsOptions = &corev1.WindowsSecurityContextOptions{}
+		}
+		userName := helperRunAsUserName
+		sc.WindowsOptions.RunAsUserName = &userName
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/cache"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/pod-security-admission/api"
+)
+
+// helper function - test pod with containers passing restricted level
+func makeRestrictedTestPod() *corev1.Pod {
+	pod := makeTestPod()
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault}}
+	restrict := func(containers []corev1.Container) {
+		for i := range containers {
+			runAsNonRoot := true
+			containers[i].SecurityContext = &corev1.SecurityContext{
+				AllowPrivilegeEscalation: new(bool),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{capabilityAll}},
+				RunAsNonRoot:             &runAsNonRoot,
+			}
+		}
+	}
+	restrict(pod.Spec.InitContainers)
+	restrict(pod.Spec.Containers)
+	return pod
+}
+
+// helper function - Windows test pod with containers passing restricted level
+func makeWindowsRestrictedTestPod() *corev1.Pod {
+	pod := makeTestPod()
+	runAsNonRoot := true
+	pod.Spec.OS = &corev1.PodOS{Name: corev1.Windows}
+	pod.Spec.SecurityContext = &corev1.PodSecurityContext{RunAsNonRoot: &runAsNonRoot}
+	return pod
+}
+
+func Test_mutatingWebhook_mutatePod_podSecurity(t *testing.T) {
+	enabled := true
+	runAsUser := int64(1000)
+	tests := []struct {
+		name     string
+		level    api.Level
+		pod      func() *corev1.Pod
+		template string
+		wantSC   *corev1.SecurityContext
+		wantWarn bool
+		wantErr  bool
+	}{
+		{
+			name:  "no Pod Security label",
+			pod:   makeTestPod,
+			level: "",
+		},
+		{
+			name:  "restricted namespace",
+			level: api.LevelRestricted,
+			pod:   makeRestrictedTestPod,
+			wantSC: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: new(bool),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{capabilityAll}},
+				RunAsNonRoot:             &enabled,
+				RunAsUser:                func() *int64 { u := helperRunAsUser; return &u }(),
+			},
+		},
+		{
+			name:  "restricted namespace with pod user",
+			level: api.LevelRestricted,
+			pod: func() *corev1.Pod {
+				pod := makeRestrictedTestPod()
+				pod.Spec.SecurityContext.RunAsUser = &runAsUser
+				return pod
+			},
+			wantSC: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: new(bool),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{capabilityAll}},
+				RunAsNonRoot:             &enabled,
+			},
+		},
+		{
+			name:  "pod that cannot pass restricted level",
+			level: api.LevelRestricted,
+			pod:   makeTestPod,
+			wantSC: &corev1.SecurityContext{
+				AllowPrivilegeEscalation: new(bool),
+				Capabilities:             &corev1.Capabilities{Drop: []corev1.Capability{capabilityAll}},
+				RunAsNonRoot:             &enabled,
+				RunAsUser:                func() *int64 { u := helperRunAsUser; return &u }(),
+				SeccompProfile:           &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeRuntimeDefault},
+			},
+			wantWarn: true,
+		},
+		{
+			name:  "windows pod in restricted namespace",
+			level: api.LevelRestricted,
+			pod:   makeWindowsRestrictedTestPod,
+			wantSC: &corev1.SecurityContext{
+				WindowsOptions: &corev1.WindowsSecurityContextOptions{RunAsUserName: func() *string { u := helperRunAsUserName; return &u }()},
+			},
+		},
+		{
+			name:  "hostProcess windows pod in baseline namespace",
+			level: api.LevelBaseline,
+			pod: func() *corev1.Pod {
+				pod := makeWindowsRestrictedTestPod()
+				pod.Spec.SecurityContext.WindowsOptions = &corev1.WindowsSecurityContextOptions{HostProcess: &enabled}
+				return pod
+			},
+			wantWarn: true,
+		},
+		{
+			name:  "privileged container in baseline namespace",
+			level: api.LevelBaseline,
+			pod: func() *corev1.Pod {
+				pod := makeTestPod()
+				pod.Spec.Containers[1].SecurityContext = &corev1.SecurityContext{Privileged: &enabled}
+				return pod
+			},
+			wantWarn: true,
+		},
+		{
+			name:  "unconfined seccomp profile in baseline namespace",
+			level: api.LevelBaseline,
+			pod: func() *corev1.Pod {
+				pod := makeTestPod()
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{SeccompProfile: &corev1.SeccompProfile{Type: corev1.SeccompProfileTypeUnconfined}}
+				return pod
+			},
+			wantWarn: true,
+		},
+		{
+			name:  "unsafe sysctl in baseline namespace",
+			level: api.LevelBaseline,
+			pod: func() *corev1.Pod {
+				pod := makeTestPod()
+				pod.Spec.SecurityContext = &corev1.PodSecurityContext{Sysctls: []corev1.Sysctl{{Name: "kernel.msgmax", Value: "65536"}}}
+				return pod
+			},
+			wantWarn: true,
+		},
+		{
+			name:  "unmasked proc mount in baseline namespace",
+			level: api.LevelBaseline,
+			pod: func() *corev1.Pod {
+				pod := makeTestPod()
+				procMount := corev1.UnmaskedProcMount
+				pod.Spec.Containers[0].SecurityContext = &corev1.SecurityContext{ProcMount: &procMount}
+				return pod
+			},
+			wantWarn: true,
+		},
+		{
+			name:     "helper template conflicting with restricted level",
+			level:    api.LevelRestricted,
+			pod:      makeRestrictedTestPod,
+			template: "container:\n  securityContext:\n    allowPrivilegeEscalation: true\n",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "test-ns"}}
+			if tt.level != "" {
+				namespace.Labels = map[string]string{api.EnforceLevelLabel: string(tt.level)}
+			}
+			template, err := parseHelperTemplate([]byte(tt.template))
+			if err != nil {
+				t.Fatal(err)
+			}
+			mw := &mutatingWebhook{
+				k8sClient:      fake.NewSimpleClientset(namespace),
+				registry:       &MockRegistry{Image: v1.Config{}},
+				provider:       "aws",
+				image:          secretsInitImage,
+				volumeName:     binVolumeName,
+				volumePath:     binVolumePath,
+				helperTemplate: template,
+				osImages:       map[string]string{"windows": testWindowsImage},
+			}
+			pod := tt.pod()
+			warnings, err := mw.mutatePod(context.TODO(), pod, "test-ns", false)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mutatingWebhook.mutatePod() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrPodSecurity) {
+					t.Errorf("mutatingWebhook.mutatePod() error = %v, want %v", err, ErrPodSecurity)
+				}
+				return
+			}
+			// Pod Security Admission exemptions are not known to the webhook: violations are only warnings
+			warned := len(warnings) > 0 && strings.Contains(warnings[len(warnings)-1], "would be rejected regardless of secrets-init")
+			if warned != tt.wantWarn {
+				t.Errorf("mutatingWebhook.mutatePod() warnings = %v, want Pod Security warning %v", warnings, tt.wantWarn)
+			}
+			if got := pod.Spec.InitContainers[0].SecurityContext; !reflect.DeepEqual(got, tt.wantSC) {
+				t.Errorf("secrets-init container securityContext = %+v, want %+v", got, tt.wantSC)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_podSecurityLevel_cache(t *testing.T) {
+	namespace := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{
+		Name:   "test-ns",
+		Labels: map[string]string{api.EnforceLevelLabel: string(api.LevelBaseline), api.EnforceVersionLabel: "v1.30"},
+	}}
+	client := fake.NewSimpleClientset(namespace)
+	mw := &mutatingWebhook{k8sClient: client, namespaceLevels: cache.NewLRUExpireCache(namespaceLevelCacheSize)}
+	want := api.LevelVersion{Level: api.LevelBaseline, Version: api.MajorMinorVersion(1, 30)}
+	for i := 0; i < 2; i++ {
+		if got := mw.podSecurityLevel(context.TODO(), "test-ns"); got != want {
+			t.Errorf("mutatingWebhook.podSecurityLevel() = %v, want %v", got, want)
+		}
+	}
+	if gets := countGets(client, "namespaces"); gets != 1 {
+		t.Errorf("namespace gets = %d, want 1", gets)
+	}
+}
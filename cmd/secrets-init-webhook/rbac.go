@@ -0,0 +1,179 @@
+package main
+
+import (
+	"io"
+	"os"
+	"sort"
+	"text/template"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// rbacTemplate webhook RBAC manifests; Secrets are read cluster wide or only in namespaces with read secret access;
+// impersonation or SubjectAccessReview permissions are granted for matching object access; ConfigMaps and Secrets
+// are listed and watched only by the object cache
+var rbacTemplate = template.Must(template.New("rbac").Parse(`apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: secrets-init-webhook-cr
+  labels:
+    app: secrets-init-webhook
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - pods
+  - events
+  verbs:
+  - "*"
+- apiGroups:
+  - apps
+  resources:
+  - deployments
+  - daemonsets
+  - replicasets
+  - statefulsets
+  verbs:
+  - "*"
+- apiGroups:
+  - autoscaling
+  resources:
+  - "*"
+  verbs:
+  - "*"
+- apiGroups:
+  - ""
+  resources:
+  - serviceaccounts
+  - namespaces
+  verbs:
+  - get
+- apiGroups:
+  - ""
+  resources:
+{{- if .ReadSecrets }}
+  - secrets
+{{- end }}
+  - configmaps
+  verbs:
+  - get
+{{- if .ObjectCache }}
+  - list
+  - watch
+{{- end }}
+{{- if .SubjectAccessReview }}
+- apiGroups:
+  - authorization.k8s.io
+  resources:
+  - subjectaccessreviews
+  verbs:
+  - create
+{{- end }}
+{{- if .Impersonate }}
+- apiGroups:
+  - ""
+  resources:
+  - users
+  - groups
+  - serviceaccounts
+  verbs:
+  - impersonate
+- apiGroups:
+  - authentication.k8s.io
+  resources:
+  - userextras/*
+  - uids
+  verbs:
+  - impersonate
+{{- end }}
+{{- range .SecretNamespaces }}
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: secrets-init-webhook-secrets
+  namespace: {{ . }}
+  labels:
+    app: secrets-init-webhook
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - secrets
+  verbs:
+  - get
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: RoleBinding
+metadata:
+  name: secrets-init-webhook-secrets
+  namespace: {{ . }}
+  labels:
+    app: secrets-init-webhook
+subjects:
+- kind: ServiceAccount
+  name: {{ $.ServiceAccount }}
+  namespace: {{ $.Namespace }}
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: Role
+  name: secrets-init-webhook-secrets
+{{- end }}
+`))
+
+type rbacConfig struct {
+	// ReadSecrets grant cluster wide Secrets access
+	ReadSecrets bool
+	// SecretNamespaces namespaces to grant Secrets access in, when Secrets are not read cluster wide
+	SecretNamespaces []string
+	// Impersonate grant impersonation of admission request users
+	Impersonate bool
+	// SubjectAccessReview grant SubjectAccessReview creation to check admission request user access
+	SubjectAccessReview bool
+	// ObjectCache grant list and watch on ConfigMaps (and Secrets, if read) for the object cache informers
+	ObjectCache bool
+	// ServiceAccount and Namespace of the webhook ServiceAccount
+	ServiceAccount string
+	Namespace      string
+}
+
+// writeRBAC writes RBAC manifests matching the webhook secret and object access configuration
+func writeRBAC(w io.Writer, secretAccess string, secretAccessNamespaces map[string]string, objectAccess string, objectCache bool,
+	serviceAccount, namespace string) error {
+	config := rbacConfig{
+		ReadSecrets:         secretAccess == secretAccessRead,
+		Impersonate:         objectAccess == objectAccessImpersonate,
+		SubjectAccessReview: objectAccess == objectAccessSubjectAccessReview,
+		ObjectCache:         objectCache,
+		ServiceAccount:      serviceAccount,
+		Namespace:           namespace,
+	}
+	if !config.ReadSecrets {
+		for ns, mode := range secretAccessNamespaces {
+			if mode == secretAccessRead {
+				config.SecretNamespaces = append(config.SecretNamespaces, ns)
+			}
+		}
+		sort.Strings(config.SecretNamespaces)
+	}
+	return errors.Wrap(rbacTemplate.Execute(w, config), "failed to write RBAC manifests")
+}
+
+// generateRBAC prints RBAC manifests for the secret and object access configuration
+func generateRBAC(c *cli.Context) error {
+	secretAccess := c.String("secret-access")
+	if !isSecretAccess(secretAccess) {
+		return errors.Wrapf(ErrInvalidSecretAccess, "secret-access: %q", secretAccess)
+	}
+	secretAccessNamespaces, err := parseSecretAccessNamespaces(c.StringSlice("secret-access-namespace"))
+	if err != nil {
+		return err
+	}
+	objectAccess := c.String("object-access")
+	if !isObjectAccess(objectAccess) {
+		return errors.Wrapf(ErrInvalidObjectAccess, "object-access: %q", objectAccess)
+	}
+	return writeRBAC(os.Stdout, secretAccess, secretAccessNamespaces, objectAccess, c.Bool("object-cache"),
+		c.String("service-account"), c.String("service-account-namespace"))
+}
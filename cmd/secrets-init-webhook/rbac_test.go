@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+)
+
+func Test_writeRBAC_deploymentManifests(t *testing.T) {
+	tests := []struct {
+		file         string
+		secretAccess string
+	}{
+		{file: "../../deployment/clusterrole.yaml", secretAccess: secretAccessRead},
+		{file: "../../deployment/clusterrole-no-secrets.yaml", secretAccess: secretAccessNone},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			want, err := os.ReadFile(tt.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got bytes.Buffer
+			if err = writeRBAC(&got, tt.secretAccess, nil, objectAccessWebhook, false, "secrets-init-webhook-sa", "default"); err != nil {
+				t.Fatal(err)
+			}
+			if got.String() != string(want) {
+				t.Errorf("writeRBAC() does not match %s, run `make rbac`:\n%s", tt.file, got.String())
+			}
+		})
+	}
+}
+
+func Test_writeRBAC_secretNamespaces(t *testing.T) {
+	var got bytes.Buffer
+	namespaces := map[string]string{"team-b": secretAccessRead, "team-a": secretAccessRead, "team-c": secretAccessNone}
+	if err := writeRBAC(&got, secretAccessNone, namespaces, objectAccessWebhook, false, "webhook", "secrets-init"); err != nil {
+		t.Fatal(err)
+	}
+	manifests := strings.Split(got.String(), "---\n")
+	if len(manifests) != 5 {
+		t.Fatalf("writeRBAC() = %d manifests, want ClusterRole and Role with RoleBinding for 2 namespaces", len(manifests))
+	}
+	if strings.Contains(manifests[0], "- secrets\n") {
+		t.Errorf("writeRBAC() ClusterRole grants Secrets access:\n%s", manifests[0])
+	}
+	for i, ns := range []string{"team-a", "team-a", "team-b", "team-b"} {
+		if !strings.Contains(manifests[i+1], "namespace: "+ns+"\n") {
+			t.Errorf("writeRBAC() manifest %d is not in %s namespace:\n%s", i+1, ns, manifests[i+1])
+		}
+	}
+	if !strings.Contains(manifests[2], "name: webhook\n  namespace: secrets-init\n") {
+		t.Errorf("writeRBAC() RoleBinding subject is not webhook ServiceAccount:\n%s", manifests[2])
+	}
+}
+
+func Test_writeRBAC_objectAccess(t *testing.T) {
+	tests := []struct {
+		objectAccess string
+		want         string
+		notWant      string
+	}{
+		{objectAccess: objectAccessWebhook, notWant: "impersonate"},
+		{objectAccess: objectAccessImpersonate, want: "  - impersonate\n", notWant: "subjectaccessreviews"},
+		{objectAccess: objectAccessSubjectAccessReview, want: "  - subjectaccessreviews\n", notWant: "impersonate"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.objectAccess, func(t *testing.T) {
+			var got bytes.Buffer
+			if err := writeRBAC(&got, secretAccessRead, nil, tt.objectAccess, false, "secrets-init-webhook-sa", "default"); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got.String(), tt.want) || strings.Contains(got.String(), tt.notWant) {
+				t.Errorf("writeRBAC() = %s, want %q and no %q", got.String(), tt.want, tt.notWant)
+			}
+		})
+	}
+}
+
+func Test_writeRBAC_objectCache(t *testing.T) {
+	for _, objectCache := range []bool{false, true} {
+		var got bytes.Buffer
+		if err := writeRBAC(&got, secretAccessRead, nil, objectAccessWebhook, objectCache, "secrets-init-webhook-sa", "default"); err != nil {
+			t.Fatal(err)
+		}
+		if watch := strings.Contains(got.String(), "  - list\n  - watch\n"); watch != objectCache {
+			t.Errorf("writeRBAC(objectCache=%v) grants list and watch = %v:\n%s", objectCache, watch, got.String())
+		}
+	}
+}
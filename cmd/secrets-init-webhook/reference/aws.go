@@ -0,0 +1,122 @@
+package reference
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	awsSecretsManagerPrefix = "arn:aws:secretsmanager"
+	awsParameterStorePrefix = "arn:aws:ssm"
+	awsSecretResource       = "secret:"
+	awsParameterResource    = "parameter/"
+)
+
+// ARN fields: arn:partition:service:region:account-id:resource
+const (
+	arnRegion = iota + 3
+	arnAccount
+	arnResource
+	arnSections
+)
+
+// Secrets Manager resource fields: secret:<name>[:<json-key>[:<version-stage>[:<version-id>]]]
+const (
+	secretName = iota + 1
+	secretJSONKey
+	secretVersionStage
+	secretVersionID
+	secretFields
+)
+
+var (
+	// AWSRegionRegexp AWS region name, e.g. us-east-1 or us-gov-west-1
+	AWSRegionRegexp  = regexp.MustCompile(`^[a-z]{2}(-[a-z]+)+-\d+$`)
+	awsAccountRegexp = regexp.MustCompile(`^\d{12}$`)
+)
+
+// parseARN parses common ARN fields into reference and returns ARN resource
+func parseARN(ref *SecretReference, service string) (string, error) {
+	sections := strings.SplitN(ref.Raw, ":", arnSections)
+	if len(sections) < arnSections {
+		return "", errors.Wrapf(ErrInvalidReference, "%s ARN %q: expected arn:aws:%s:<region>:<account>:<resource>", service, ref.Raw, service)
+	}
+	ref.Region = sections[arnRegion]
+	ref.Account = sections[arnAccount]
+	if !AWSRegionRegexp.MatchString(ref.Region) {
+		return sections[arnResource], errors.Wrapf(ErrInvalidReference, "%s ARN %q: invalid region %q", service, ref.Raw, ref.Region)
+	}
+	if !awsAccountRegexp.MatchString(ref.Account) {
+		return sections[arnResource], errors.Wrapf(ErrInvalidReference, "%s ARN %q: invalid account ID %q", service, ref.Raw, ref.Account)
+	}
+	return sections[arnResource], nil
+}
+
+// AWSSecretsManager matches AWS Secrets Manager secret ARN
+//
+//	arn:aws:secretsmanager:<region>:<account>:secret:<name>[:<json-key>[:<version-stage>[:<version-id>]]]
+type AWSSecretsManager struct{}
+
+// Match reports whether value is AWS Secrets Manager ARN
+func (AWSSecretsManager) Match(value string) bool {
+	return strings.HasPrefix(value, awsSecretsManagerPrefix)
+}
+
+// Parse AWS Secrets Manager ARN
+func (AWSSecretsManager) Parse(value string) (*SecretReference, error) {
+	ref := &SecretReference{Provider: AWS, Service: "secretsmanager", Raw: value}
+	resource, err := parseARN(ref, ref.Service)
+	resourceFields := strings.Split(resource, ":")
+	field := func(i int) string {
+		if len(resourceFields) > i {
+			return resourceFields[i]
+		}
+		return ""
+	}
+	ref.Name = field(secretName)
+	ref.Key = field(secretJSONKey)
+	// prefer version ID over version stage
+	ref.Version = field(secretVersionID)
+	if ref.Version == "" {
+		ref.Version = field(secretVersionStage)
+	}
+	if err != nil {
+		return ref, err
+	}
+	if !strings.HasPrefix(resource, awsSecretResource) || ref.Name == "" || len(resourceFields) > secretFields {
+		return ref, errors.Wrapf(ErrInvalidReference,
+			"secretsmanager ARN %q: expected secret:<name>[:<json-key>[:<version-stage>[:<version-id>]]] resource", value)
+	}
+	return ref, nil
+}
+
+// AWSParameterStore matches AWS SSM Parameter Store parameter ARN
+//
+//	arn:aws:ssm:<region>:<account>:parameter/<name>[:<version>]
+type AWSParameterStore struct{}
+
+// Match reports whether value is AWS SSM parameter ARN
+func (AWSParameterStore) Match(value string) bool {
+	return strings.HasPrefix(value, awsParameterStorePrefix) && strings.Contains(value, ":"+awsParameterResource)
+}
+
+// Parse AWS SSM parameter ARN
+func (AWSParameterStore) Parse(value string) (*SecretReference, error) {
+	ref := &SecretReference{Provider: AWS, Service: "ssm", Raw: value}
+	resource, err := parseARN(ref, ref.Service)
+	// parameter/<name>[:<version>]
+	name := strings.TrimPrefix(resource, awsParameterResource)
+	if i := strings.LastIndex(name, ":"); i >= 0 {
+		name, ref.Version = name[:i], name[i+1:]
+	}
+	ref.Name = name
+	if err != nil {
+		return ref, err
+	}
+	if !strings.HasPrefix(resource, awsParameterResource) || strings.Trim(ref.Name, "/") == "" {
+		return ref, errors.Wrapf(ErrInvalidReference, "ssm ARN %q: missing parameter name", value)
+	}
+	return ref, nil
+}
@@ -0,0 +1,68 @@
+package reference
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	azureKeyVaultPrefix    = "azure:keyvault:"
+	azureKeyVaultURLPrefix = "https://"
+	azureKeyVaultDNSSuffix = ".vault.azure.net"
+	azureKeyVaultSecrets   = "secrets"
+	// <name>[/<version>]
+	azureKeyVaultSegments = 2
+)
+
+// AzureKeyVault matches Azure Key Vault secret identifier or prefixed reference
+//
+//	https://<vault>.vault.azure.net/secrets/<name>[/<version>]
+//	azure:keyvault:<vault>/<name>[/<version>]
+type AzureKeyVault struct{}
+
+// Match reports whether value is Azure Key Vault secret reference
+func (AzureKeyVault) Match(value string) bool {
+	if strings.HasPrefix(value, azureKeyVaultPrefix) {
+		return true
+	}
+	if !strings.HasPrefix(value, azureKeyVaultURLPrefix) {
+		return false
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return false
+	}
+	return strings.HasSuffix(u.Hostname(), azureKeyVaultDNSSuffix) &&
+		strings.HasPrefix(u.Path, "/"+azureKeyVaultSecrets+"/")
+}
+
+// Parse Azure Key Vault secret reference
+func (AzureKeyVault) Parse(value string) (*SecretReference, error) {
+	ref := &SecretReference{Provider: Azure, Service: "keyvault", Raw: value}
+	var segments []string
+	if strings.HasPrefix(value, azureKeyVaultPrefix) {
+		segments = strings.Split(strings.TrimPrefix(value, azureKeyVaultPrefix), "/")
+		ref.Account, segments = segments[0], segments[1:]
+	} else {
+		u, err := url.Parse(value)
+		if err != nil {
+			return ref, errors.Wrapf(ErrInvalidReference, "keyvault secret identifier %q: %v", value, err)
+		}
+		ref.Account = strings.TrimSuffix(u.Hostname(), azureKeyVaultDNSSuffix)
+		// skip "secrets" path segment
+		segments = strings.Split(strings.TrimPrefix(u.Path, "/"), "/")[1:]
+	}
+	if len(segments) > 0 {
+		ref.Name = segments[0]
+	}
+	if len(segments) > 1 {
+		ref.Version = segments[1]
+	}
+	if ref.Account == "" || ref.Name == "" || len(segments) > azureKeyVaultSegments ||
+		(len(segments) == azureKeyVaultSegments && ref.Version == "") {
+		return ref, errors.Wrapf(ErrInvalidReference, "keyvault reference %q: expected <vault>/<name>[/<version>]", value)
+	}
+	return ref, nil
+}
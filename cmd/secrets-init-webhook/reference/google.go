@@ -0,0 +1,69 @@
+package reference
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const googleSecretManagerPrefix = "gcp:secretmanager:"
+
+// Google Secret Manager resource name segments: projects/<project>/secrets/<name>[/versions/<version>]
+const (
+	gcpProject = iota + 1
+	gcpSecrets
+	gcpName
+	gcpVersions
+	gcpVersion
+)
+
+const (
+	gcpSecretSegments  = gcpName + 1
+	gcpVersionSegments = gcpVersion + 1
+)
+
+// GoogleSecretManager matches Google Secret Manager secret name
+//
+//	gcp:secretmanager:projects/<project>/secrets/<name>[/versions/<version>]
+type GoogleSecretManager struct{}
+
+// Match reports whether value is Google Secret Manager reference
+func (GoogleSecretManager) Match(value string) bool {
+	return strings.HasPrefix(value, googleSecretManagerPrefix)
+}
+
+// Parse Google Secret Manager reference
+func (GoogleSecretManager) Parse(value string) (*SecretReference, error) {
+	ref := &SecretReference{Provider: Google, Service: "secretmanager", Raw: value}
+	path := strings.TrimPrefix(value, googleSecretManagerPrefix)
+	segments := strings.Split(path, "/")
+	// name only: project is taken from secrets-init environment
+	if len(segments) == 1 {
+		ref.Name = path
+		if ref.Name == "" {
+			return ref, errors.Wrapf(ErrInvalidReference, "secretmanager reference %q: missing secret name", value)
+		}
+		return ref, nil
+	}
+	for i := 0; i+1 < len(segments); i += 2 {
+		switch segments[i] {
+		case "projects":
+			ref.Account = segments[i+1]
+		case "secrets":
+			ref.Name = segments[i+1]
+		case "versions":
+			ref.Version = segments[i+1]
+		}
+	}
+	valid := (len(segments) == gcpSecretSegments || len(segments) == gcpVersionSegments) &&
+		segments[0] == "projects" && segments[gcpProject] != "" &&
+		segments[gcpSecrets] == "secrets" && segments[gcpName] != ""
+	if valid && len(segments) == gcpVersionSegments {
+		valid = segments[gcpVersions] == "versions" && segments[gcpVersion] != ""
+	}
+	if !valid {
+		return ref, errors.Wrapf(ErrInvalidReference,
+			"secretmanager reference %q: expected projects/<project>/secrets/<name>[/versions/<version>]", value)
+	}
+	return ref, nil
+}
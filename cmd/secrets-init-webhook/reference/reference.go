@@ -0,0 +1,130 @@
+package reference
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Provider is a secrets manager backend supported by secrets-init
+type Provider string
+
+const (
+	// AWS Secrets Manager and SSM Parameter Store
+	AWS Provider = "aws"
+	// Google Secret Manager
+	Google Provider = "google"
+	// HashiCorpVault HashiCorp Vault KV secrets engine
+	HashiCorpVault Provider = "vault"
+	// Azure Key Vault
+	Azure Provider = "azure"
+)
+
+// Providers lists all supported providers
+var Providers = []Provider{AWS, Google, HashiCorpVault, Azure}
+
+var (
+	// ErrNoMatch value is not a secret reference known to any matcher
+	ErrNoMatch = errors.New("no matching secret reference")
+	// ErrInvalidReference value is recognized by a matcher, but is not a well-formed reference
+	ErrInvalidReference = errors.New("invalid secret reference")
+)
+
+// SecretReference is a parsed reference to a secret stored in a secrets manager
+type SecretReference struct {
+	// Provider secrets manager provider, as passed to secrets-init --provider flag
+	Provider Provider
+	// Service provider service: secretsmanager, ssm, secretmanager, kv, keyvault
+	Service string
+	// Account AWS account ID, GCP project or Azure Key Vault name
+	Account string
+	// Region AWS region; empty for global services
+	Region string
+	// Name secret or parameter name
+	Name string
+	// Version secret version (or stage), if specified
+	Version string
+	// Key field within secret (AWS Secrets Manager JSON key, Vault KV key), if specified
+	Key string
+	// Raw original reference value
+	Raw string
+}
+
+// String returns a short human readable description of the reference
+func (r *SecretReference) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s:%s:", r.Provider, r.Service)
+	if r.Account != "" {
+		sb.WriteString(r.Account)
+		sb.WriteString("/")
+	}
+	if r.Region != "" {
+		sb.WriteString(r.Region)
+		sb.WriteString("/")
+	}
+	sb.WriteString(r.Name)
+	if r.Key != "" {
+		sb.WriteString("#")
+		sb.WriteString(r.Key)
+	}
+	if r.Version != "" {
+		sb.WriteString("@")
+		sb.WriteString(r.Version)
+	}
+	return sb.String()
+}
+
+// Matcher recognizes and parses secret references of a single secrets manager service
+type Matcher interface {
+	// Match reports whether the value is a reference handled by this matcher
+	Match(value string) bool
+	// Parse parses the value into a typed secret reference; for a malformed value it returns
+	// ErrInvalidReference together with the partially parsed reference
+	Parse(value string) (*SecretReference, error)
+}
+
+// Registry is an ordered list of secret reference matchers
+type Registry struct {
+	matchers []Matcher
+}
+
+// NewRegistry creates registry with provided matchers
+func NewRegistry(matchers ...Matcher) *Registry {
+	return &Registry{matchers: matchers}
+}
+
+// Register appends matcher to the registry
+func (r *Registry) Register(m Matcher) {
+	r.matchers = append(r.matchers, m)
+}
+
+// Lookup parses value with the first matcher that matches it; returns ErrNoMatch if none does
+// and ErrInvalidReference (with partially parsed reference) if value is malformed
+func (r *Registry) Lookup(value string) (*SecretReference, error) {
+	for _, m := range r.matchers {
+		if m.Match(value) {
+			return m.Parse(value)
+		}
+	}
+	return nil, ErrNoMatch
+}
+
+// defaultRegistry holds all built-in matchers
+var defaultRegistry = NewRegistry(
+	AWSSecretsManager{},
+	AWSParameterStore{},
+	GoogleSecretManager{},
+	Vault{},
+	AzureKeyVault{},
+)
+
+// Default returns registry with all built-in matchers
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// Lookup parses value with the built-in matchers
+func Lookup(value string) (*SecretReference, error) {
+	return defaultRegistry.Lookup(value)
+}
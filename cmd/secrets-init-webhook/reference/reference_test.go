@@ -0,0 +1,198 @@
+package reference
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+//nolint:funlen
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    *SecretReference
+		wantErr error
+	}{
+		{
+			name:  "aws secrets manager",
+			value: "arn:aws:secretsmanager:us-east-1:123456789012:secret:test/topsecret",
+			want: &SecretReference{
+				Provider: AWS,
+				Service:  "secretsmanager",
+				Account:  "123456789012",
+				Region:   "us-east-1",
+				Name:     "test/topsecret",
+			},
+		},
+		{
+			name:  "aws secrets manager with json key and version stage",
+			value: "arn:aws:secretsmanager:eu-west-1:123456789012:secret:db:password:AWSPREVIOUS",
+			want: &SecretReference{
+				Provider: AWS,
+				Service:  "secretsmanager",
+				Account:  "123456789012",
+				Region:   "eu-west-1",
+				Name:     "db",
+				Key:      "password",
+				Version:  "AWSPREVIOUS",
+			},
+		},
+		{
+			name:  "aws ssm parameter",
+			value: "arn:aws:ssm:us-west-2:123456789012:parameter/api/key",
+			want: &SecretReference{
+				Provider: AWS,
+				Service:  "ssm",
+				Account:  "123456789012",
+				Region:   "us-west-2",
+				Name:     "api/key",
+			},
+		},
+		{
+			name:  "aws ssm parameter with version",
+			value: "arn:aws:ssm:us-west-2:123456789012:parameter/api/key:3",
+			want: &SecretReference{
+				Provider: AWS,
+				Service:  "ssm",
+				Account:  "123456789012",
+				Region:   "us-west-2",
+				Name:     "api/key",
+				Version:  "3",
+			},
+		},
+		{
+			name:    "aws ssm non-parameter resource",
+			value:   "arn:aws:ssm:us-west-2:123456789012:document/doc",
+			wantErr: ErrNoMatch,
+		},
+		{
+			name:  "google secret manager",
+			value: "gcp:secretmanager:projects/my-project/secrets/mydbpassword/versions/2",
+			want: &SecretReference{
+				Provider: Google,
+				Service:  "secretmanager",
+				Account:  "my-project",
+				Name:     "mydbpassword",
+				Version:  "2",
+			},
+		},
+		{
+			name:  "google secret manager name only",
+			value: "gcp:secretmanager:topsecret",
+			want: &SecretReference{
+				Provider: Google,
+				Service:  "secretmanager",
+				Name:     "topsecret",
+			},
+		},
+		{
+			name:  "vault kv",
+			value: "vault:secret/data/app#password",
+			want: &SecretReference{
+				Provider: HashiCorpVault,
+				Service:  "kv",
+				Name:     "secret/data/app",
+				Key:      "password",
+			},
+		},
+		{
+			name:  "vault kv with version",
+			value: "vault:secret/data/app?version=2#password",
+			want: &SecretReference{
+				Provider: HashiCorpVault,
+				Service:  "kv",
+				Name:     "secret/data/app",
+				Key:      "password",
+				Version:  "2",
+			},
+		},
+		{
+			name:  "azure key vault secret identifier",
+			value: "https://my-vault.vault.azure.net/secrets/db-password/0123456789abcdef",
+			want: &SecretReference{
+				Provider: Azure,
+				Service:  "keyvault",
+				Account:  "my-vault",
+				Name:     "db-password",
+				Version:  "0123456789abcdef",
+			},
+		},
+		{
+			name:  "azure key vault prefix",
+			value: "azure:keyvault:my-vault/db-password",
+			want: &SecretReference{
+				Provider: Azure,
+				Service:  "keyvault",
+				Account:  "my-vault",
+				Name:     "db-password",
+			},
+		},
+		{
+			name:    "azure key vault url without secret",
+			value:   "https://my-vault.vault.azure.net/",
+			wantErr: ErrNoMatch,
+		},
+		{
+			name:    "aws secrets manager missing region",
+			value:   "arn:aws:secretsmanager::123456789012:secret:test/topsecret",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "aws secrets manager missing account",
+			value:   "arn:aws:secretsmanager:us-east-1:secret:test/topsecret",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "aws secrets manager missing secret name",
+			value:   "arn:aws:secretsmanager:us-east-1:123456789012:secret:",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "aws ssm missing parameter name",
+			value:   "arn:aws:ssm:us-west-2:123456789012:parameter/",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "google secret manager bad path",
+			value:   "gcp:secretmanager:projects/my-project/secret/mydbpassword",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "google secret manager missing version",
+			value:   "gcp:secretmanager:projects/my-project/secrets/mydbpassword/versions/",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "vault empty key",
+			value:   "vault:secret/data/app#",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "azure key vault missing secret name",
+			value:   "azure:keyvault:my-vault",
+			wantErr: ErrInvalidReference,
+		},
+		{
+			name:    "plain value",
+			value:   "hello world",
+			wantErr: ErrNoMatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Lookup(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Lookup() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			tt.want.Raw = tt.value
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Lookup() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
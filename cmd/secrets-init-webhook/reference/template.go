@@ -0,0 +1,49 @@
+package reference
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	templateStart = "${"
+	templateEnd   = "}"
+)
+
+// LookupTemplate parses secret references embedded in value with ${<reference>} placeholders;
+// placeholders that are not secret references (e.g. ${HOME}) are ignored. Returns ErrNoMatch if value
+// has no embedded references and ErrInvalidReference (with all parsed references) if any is malformed.
+func (r *Registry) LookupTemplate(value string) ([]*SecretReference, error) {
+	var refs []*SecretReference
+	var invalid error
+	for rest := value; ; {
+		start := strings.Index(rest, templateStart)
+		if start < 0 {
+			break
+		}
+		rest = rest[start+len(templateStart):]
+		end := strings.Index(rest, templateEnd)
+		if end < 0 {
+			break
+		}
+		ref, err := r.Lookup(rest[:end])
+		rest = rest[end+len(templateEnd):]
+		if errors.Is(err, ErrNoMatch) {
+			continue
+		}
+		if err != nil && invalid == nil {
+			invalid = err
+		}
+		refs = append(refs, ref)
+	}
+	if len(refs) == 0 {
+		return nil, ErrNoMatch
+	}
+	return refs, invalid
+}
+
+// LookupTemplate parses secret references embedded in value with the built-in matchers
+func LookupTemplate(value string) ([]*SecretReference, error) {
+	return defaultRegistry.LookupTemplate(value)
+}
@@ -0,0 +1,64 @@
+package reference
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLookupTemplate(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		wantNames []string
+		wantErr   error
+	}{
+		{
+			name:      "connection string",
+			value:     "postgres://app:${arn:aws:secretsmanager:us-east-1:123456789012:secret:db}@db:5432/app",
+			wantNames: []string{"db"},
+		},
+		{
+			name:      "multiple references",
+			value:     "Bearer ${gcp:secretmanager:projects/p/secrets/token} ${vault:secret/data/app#key}",
+			wantNames: []string{"token", "secret/data/app"},
+		},
+		{
+			name:    "non-reference placeholder",
+			value:   "${HOME}/app",
+			wantErr: ErrNoMatch,
+		},
+		{
+			name:    "whole value reference",
+			value:   "gcp:secretmanager:projects/p/secrets/token",
+			wantErr: ErrNoMatch,
+		},
+		{
+			name:      "malformed reference",
+			value:     "user:${arn:aws:secretsmanager:us-east-1:secret:db}",
+			wantNames: []string{""},
+			wantErr:   ErrInvalidReference,
+		},
+		{
+			name:    "unterminated placeholder",
+			value:   "user:${arn:aws:secretsmanager:us-east-1:123456789012:secret:db",
+			wantErr: ErrNoMatch,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LookupTemplate(tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LookupTemplate() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if len(got) != len(tt.wantNames) {
+				t.Fatalf("LookupTemplate() = %v, want names %v", got, tt.wantNames)
+			}
+			for i, ref := range got {
+				if ref.Name != tt.wantNames[i] {
+					t.Errorf("LookupTemplate()[%d].Name = %q, want %q", i, ref.Name, tt.wantNames[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package reference
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	vaultPrefix  = "vault:"
+	vaultVersion = "?version="
+)
+
+// Vault matches HashiCorp Vault KV secret reference
+//
+//	vault:<mount>/data/<path>[?version=<version>]#<key>
+type Vault struct{}
+
+// Match reports whether value is HashiCorp Vault reference
+func (Vault) Match(value string) bool {
+	return strings.HasPrefix(value, vaultPrefix)
+}
+
+// Parse HashiCorp Vault reference
+func (Vault) Parse(value string) (*SecretReference, error) {
+	ref := &SecretReference{Provider: HashiCorpVault, Service: "kv", Raw: value}
+	path := strings.TrimPrefix(value, vaultPrefix)
+	hasKey := false
+	if i := strings.LastIndex(path, "#"); i >= 0 {
+		path, ref.Key, hasKey = path[:i], path[i+1:], true
+	}
+	if i := strings.Index(path, vaultVersion); i >= 0 {
+		path, ref.Version = path[:i], path[i+len(vaultVersion):]
+	}
+	ref.Name = path
+	if strings.Trim(ref.Name, "/") == "" || strings.HasPrefix(ref.Name, "/") {
+		return ref, errors.Wrapf(ErrInvalidReference, "vault reference %q: expected <mount>/<path>", value)
+	}
+	if hasKey && ref.Key == "" {
+		return ref, errors.Wrapf(ErrInvalidReference, "vault reference %q: empty key", value)
+	}
+	if ref.Version != "" {
+		if _, err := strconv.ParseUint(ref.Version, 10, 64); err != nil {
+			return ref, errors.Wrapf(ErrInvalidReference, "vault reference %q: invalid version %q", value, ref.Version)
+		}
+	}
+	return ref, nil
+}
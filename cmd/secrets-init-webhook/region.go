@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/doitintl/kube-secrets-init/cmd/secrets-init-webhook/reference"
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	awsRegionEnv        = "AWS_REGION"
+	awsDefaultRegionEnv = "AWS_DEFAULT_REGION"
+	googleProjectEnv    = "GOOGLE_CLOUD_PROJECT"
+
+	// awsMultiRegionConstraint secrets-init image versions resolving AWS references with the region of each ARN
+	awsMultiRegionConstraint = latestImageConstraint
+)
+
+// ErrMultipleRegions container references AWS secrets in more than one region
+var ErrMultipleRegions = errors.New("secret references from multiple AWS regions")
+
+func hasEnv(env []corev1.EnvVar, name string) bool {
+	for _, e := range env {
+		if e.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceValues returns sorted unique values of reference field for provider references
+func referenceValues(provider string, envVars []secretEnvVar, field func(ref *reference.SecretReference) string) []string {
+	var values []string
+	for _, env := range envVars {
+		for _, ref := range env.references() {
+			if string(ref.Provider) == provider && field(ref) != "" && !contains(values, field(ref)) {
+				values = append(values, field(ref))
+			}
+		}
+	}
+	sort.Strings(values)
+	return values
+}
+
+// referenceEnv returns AWS region or GCP project env vars derived from secret references of the selected provider;
+// env vars the container already defines are left alone
+func (mw *mutatingWebhook) referenceEnv(provider string, envVars []secretEnvVar, defined func(name string) bool) ([]corev1.EnvVar, error) {
+	switch reference.Provider(provider) {
+	case reference.AWS:
+		regions := referenceValues(provider, envVars, func(ref *reference.SecretReference) string { return ref.Region })
+		if len(regions) > 1 {
+			if checkImageVersion(mw.image, awsMultiRegionConstraint) {
+				// secrets-init resolves each reference in its own region
+				return nil, nil
+			}
+			return nil, errors.Wrapf(ErrMultipleRegions, "%s; secrets-init image %s supports a single region", strings.Join(regions, ", "), mw.image)
+		}
+		if len(regions) == 0 || defined(awsRegionEnv) || defined(awsDefaultRegionEnv) {
+			return nil, nil
+		}
+		return []corev1.EnvVar{{Name: awsRegionEnv, Value: regions[0]}, {Name: awsDefaultRegionEnv, Value: regions[0]}}, nil
+	case reference.Google:
+		projects := referenceValues(provider, envVars, func(ref *reference.SecretReference) string { return ref.Account })
+		// references name their project: project env is only a default for a single project
+		if len(projects) != 1 || defined(googleProjectEnv) {
+			return nil, nil
+		}
+		return []corev1.EnvVar{{Name: googleProjectEnv, Value: projects[0]}}, nil
+	case reference.HashiCorpVault, reference.Azure:
+	}
+	return nil, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func Test_mutatingWebhook_mutateContainers_referenceEnv(t *testing.T) {
+	const euSecretARN = "arn:aws:secretsmanager:eu-west-1:123456789012:secret:test/secret"
+	tests := []struct {
+		name    string
+		image   string
+		env     []corev1.EnvVar
+		wantEnv []corev1.EnvVar
+		wantErr bool
+	}{
+		{
+			name:  "region from ARN",
+			image: secretsInitImage,
+			env:   []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}},
+			wantEnv: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: awsRegionEnv, Value: "us-east-1"},
+				{Name: awsDefaultRegionEnv, Value: "us-east-1"},
+			},
+		},
+		{
+			name:  "user region is left alone",
+			image: secretsInitImage,
+			env:   []corev1.EnvVar{{Name: awsDefaultRegionEnv, Value: "eu-west-1"}, {Name: "PASSWORD", Value: testSecretARN}},
+			wantEnv: []corev1.EnvVar{
+				{Name: awsDefaultRegionEnv, Value: "eu-west-1"},
+				{Name: "PASSWORD", Value: testSecretARN},
+			},
+		},
+		{
+			name:  "project from GCP reference",
+			image: secretsInitImage,
+			env:   []corev1.EnvVar{{Name: "PASSWORD", Value: "gcp:secretmanager:projects/test-project/secrets/password"}},
+			wantEnv: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: "gcp:secretmanager:projects/test-project/secrets/password"},
+				{Name: googleProjectEnv, Value: "test-project"},
+			},
+		},
+		{
+			name:  "multiple regions with helper resolving each region",
+			image: secretsInitImage,
+			env:   []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}, {Name: "TOKEN", Value: euSecretARN}},
+			wantEnv: []corev1.EnvVar{
+				{Name: "PASSWORD", Value: testSecretARN},
+				{Name: "TOKEN", Value: euSecretARN},
+			},
+		},
+		{
+			name:    "multiple regions with single region helper",
+			image:   "doitintl/secrets-init:0.4.2",
+			env:     []corev1.EnvVar{{Name: "PASSWORD", Value: testSecretARN}, {Name: "TOKEN", Value: euSecretARN}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := &mutatingWebhook{
+				k8sClient:  fake.NewSimpleClientset(),
+				registry:   &MockRegistry{Image: v1.Config{}},
+				provider:   "aws",
+				image:      tt.image,
+				volumeName: binVolumeName,
+				volumePath: binVolumePath,
+			}
+			containers := []corev1.Container{{Name: "app", Command: []string{"app"}, Env: tt.env}}
+			_, _, err := mw.mutateContainers(context.TODO(), containers, &corev1.Pod{}, "test-ns")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mutatingWebhook.mutateContainers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(containers[0].Env, tt.wantEnv) {
+				t.Errorf("container env = %v, want %v", containers[0].Env, tt.wantEnv)
+			}
+		})
+	}
+}
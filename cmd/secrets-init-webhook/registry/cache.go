@@ -8,34 +8,40 @@ import (
 
 // ImageCache interface
 type ImageCache interface {
-	Get(image string) *v1.Config
-	Put(image string, imageConfig *v1.Config)
+	Get(image string, platform v1.Platform) *v1.ConfigFile
+	Put(image string, platform v1.Platform, imageConfig *v1.ConfigFile)
+}
+
+// imageCacheKey image config of multi-arch image differs by platform
+type imageCacheKey struct {
+	image    string
+	platform string
 }
 
 // InMemoryImageCache Concrete mutex-guarded cache
 type InMemoryImageCache struct {
 	mutex sync.Mutex
-	cache map[string]v1.Config
+	cache map[imageCacheKey]v1.ConfigFile
 }
 
 // NewInMemoryImageCache return new mutex guarded cache
 func NewInMemoryImageCache() ImageCache {
-	return &InMemoryImageCache{cache: map[string]v1.Config{}}
+	return &InMemoryImageCache{cache: map[imageCacheKey]v1.ConfigFile{}}
 }
 
 // Get image from cache
-func (c *InMemoryImageCache) Get(image string) *v1.Config {
+func (c *InMemoryImageCache) Get(image string, platform v1.Platform) *v1.ConfigFile {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	if imageConfig, ok := c.cache[image]; ok {
+	if imageConfig, ok := c.cache[imageCacheKey{image, platform.String()}]; ok {
 		return &imageConfig
 	}
 	return nil
 }
 
 // Put image into cache
-func (c *InMemoryImageCache) Put(image string, imageConfig *v1.Config) {
+func (c *InMemoryImageCache) Put(image string, platform v1.Platform, imageConfig *v1.ConfigFile) {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
-	c.cache[image] = *imageConfig
+	c.cache[imageCacheKey{image, platform.String()}] = *imageConfig
 }
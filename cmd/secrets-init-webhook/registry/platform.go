@@ -0,0 +1,111 @@
+package registry
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	// deprecated node labels, still set by kubelet and used in older manifests
+	betaLabelOS   = "beta.kubernetes.io/os"
+	betaLabelArch = "beta.kubernetes.io/arch"
+)
+
+// ParsePlatform parses platform in os/arch[/variant] form; both OS and architecture are required
+func ParsePlatform(s string) (*v1.Platform, error) {
+	platform, err := v1.ParsePlatform(s)
+	if err != nil {
+		return nil, err
+	}
+	if platform.OS == "" || platform.Architecture == "" {
+		return nil, fmt.Errorf("platform must be in os/arch[/variant] form: %q", s)
+	}
+	return platform, nil
+}
+
+// PodOS returns OS of the pod: spec.os.name, or the only OS of nodes the pod can be scheduled on,
+// as constrained by node selector and required node affinity; empty string if OS is not known
+func PodOS(podSpec *corev1.PodSpec) string {
+	if podSpec.OS != nil && podSpec.OS.Name != "" {
+		return string(podSpec.OS.Name)
+	}
+	return nodeLabelValue(podSpec, corev1.LabelOSStable, betaLabelOS)
+}
+
+// PodPlatform returns platform of nodes the pod can be scheduled on, as constrained by pod OS, node selector and
+// required node affinity; OS and architecture not constrained to a single value are taken from default platform
+func PodPlatform(podSpec *corev1.PodSpec, defaultPlatform v1.Platform) v1.Platform {
+	platform := v1.Platform{OS: defaultPlatform.OS, Architecture: defaultPlatform.Architecture}
+	if os := PodOS(podSpec); os != "" {
+		platform.OS = os
+	}
+	if arch := nodeLabelValue(podSpec, corev1.LabelArchStable, betaLabelArch); arch != "" {
+		platform.Architecture = arch
+	}
+	// variant is not exposed by node labels: keep default one for default architecture only
+	if platform.Architecture == defaultPlatform.Architecture {
+		platform.Variant = defaultPlatform.Variant
+	}
+	return platform
+}
+
+// nodeLabelValue returns the only value of node label (any of keys) allowed for the pod, or empty string
+func nodeLabelValue(podSpec *corev1.PodSpec, keys ...string) string {
+	for _, key := range keys {
+		if value, ok := podSpec.NodeSelector[key]; ok {
+			return value
+		}
+	}
+	if podSpec.Affinity == nil || podSpec.Affinity.NodeAffinity == nil ||
+		podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	// node selector terms are ORed: every term must allow the same single value
+	values := map[string]bool{}
+	for _, term := range podSpec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		allowed := termLabelValues(term, keys)
+		if allowed == nil {
+			return ""
+		}
+		for value := range allowed {
+			values[value] = true
+		}
+	}
+	if len(values) != 1 {
+		return ""
+	}
+	for value := range values {
+		return value
+	}
+	return ""
+}
+
+// termLabelValues returns values of node label allowed by node selector term, or nil if the label is not constrained;
+// match expressions of a term are ANDed
+func termLabelValues(term corev1.NodeSelectorTerm, keys []string) map[string]bool {
+	var allowed map[string]bool
+	for _, expr := range term.MatchExpressions {
+		if expr.Operator != corev1.NodeSelectorOpIn || !containsString(keys, expr.Key) {
+			continue
+		}
+		values := map[string]bool{}
+		for _, value := range expr.Values {
+			if allowed == nil || allowed[value] {
+				values[value] = true
+			}
+		}
+		allowed = values
+	}
+	return allowed
+}
+
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+package registry
+
+import (
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// helper function - pod spec with required node affinity terms
+func affinitySpec(terms ...corev1.NodeSelectorTerm) *corev1.PodSpec {
+	return &corev1.PodSpec{Affinity: &corev1.Affinity{NodeAffinity: &corev1.NodeAffinity{
+		RequiredDuringSchedulingIgnoredDuringExecution: &corev1.NodeSelector{NodeSelectorTerms: terms},
+	}}}
+}
+
+// helper function - node selector term with In expression
+func inTerm(key string, values ...string) corev1.NodeSelectorTerm {
+	return corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+		{Key: key, Operator: corev1.NodeSelectorOpIn, Values: values},
+	}}
+}
+
+func TestPodPlatform(t *testing.T) {
+	defaultPlatform := v1.Platform{OS: "linux", Architecture: "amd64"}
+	tests := []struct {
+		name            string
+		podSpec         *corev1.PodSpec
+		defaultPlatform v1.Platform
+		want            v1.Platform
+	}{
+		{
+			name:            "no constraints",
+			podSpec:         &corev1.PodSpec{},
+			defaultPlatform: defaultPlatform,
+			want:            defaultPlatform,
+		},
+		{
+			name:            "node selector",
+			podSpec:         &corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelArchStable: "arm64"}},
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name:            "beta node selector",
+			podSpec:         &corev1.PodSpec{NodeSelector: map[string]string{betaLabelArch: "arm64", betaLabelOS: "windows"}},
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "windows", Architecture: "arm64"},
+		},
+		{
+			name:            "pod os",
+			podSpec:         &corev1.PodSpec{OS: &corev1.PodOS{Name: corev1.Windows}},
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "windows", Architecture: "amd64"},
+		},
+		{
+			name:            "node affinity",
+			podSpec:         affinitySpec(inTerm(corev1.LabelArchStable, "arm64")),
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name:            "node affinity with any of architectures",
+			podSpec:         affinitySpec(inTerm(corev1.LabelArchStable, "arm64", "amd64")),
+			defaultPlatform: v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+			want:            v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"},
+		},
+		{
+			name:            "node affinity terms with the same architecture",
+			podSpec:         affinitySpec(inTerm(corev1.LabelArchStable, "arm64"), inTerm(betaLabelArch, "arm64")),
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name:            "node affinity term without architecture",
+			podSpec:         affinitySpec(inTerm(corev1.LabelArchStable, "arm64"), inTerm(corev1.LabelHostname, "node")),
+			defaultPlatform: defaultPlatform,
+			want:            defaultPlatform,
+		},
+		{
+			name: "node affinity term expressions narrowing architecture",
+			podSpec: affinitySpec(corev1.NodeSelectorTerm{MatchExpressions: []corev1.NodeSelectorRequirement{
+				{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64", "amd64"}},
+				{Key: corev1.LabelArchStable, Operator: corev1.NodeSelectorOpIn, Values: []string{"arm64"}},
+			}}),
+			defaultPlatform: defaultPlatform,
+			want:            v1.Platform{OS: "linux", Architecture: "arm64"},
+		},
+		{
+			name:            "default variant is not used for another architecture",
+			podSpec:         &corev1.PodSpec{NodeSelector: map[string]string{corev1.LabelArchStable: "amd64"}},
+			defaultPlatform: v1.Platform{OS: "linux", Architecture: "arm", Variant: "v7"},
+			want:            v1.Platform{OS: "linux", Architecture: "amd64"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PodPlatform(tt.podSpec, tt.defaultPlatform); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PodPlatform() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParsePlatform(t *testing.T) {
+	tests := []struct {
+		platform string
+		want     *v1.Platform
+		wantErr  bool
+	}{
+		{platform: "linux/amd64", want: &v1.Platform{OS: "linux", Architecture: "amd64"}},
+		{platform: "linux/arm64/v8", want: &v1.Platform{OS: "linux", Architecture: "arm64", Variant: "v8"}},
+		{platform: "linux", wantErr: true},
+		{platform: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.platform, func(t *testing.T) {
+			got, err := ParsePlatform(tt.platform)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePlatform() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePlatform() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
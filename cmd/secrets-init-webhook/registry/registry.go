@@ -19,6 +19,7 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"sort"
 
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/authn/k8schain"
@@ -38,7 +39,19 @@ type ImageRegistry interface {
 		namespace string,
 		container *corev1.Container,
 		podSpec *corev1.PodSpec,
-	) (*v1.Config, error)
+	) (*v1.ConfigFile, error)
+}
+
+// PlatformError multi-arch image has no image for OS of the platform
+type PlatformError struct {
+	Image    string
+	Platform v1.Platform
+	// OSes OS of images in the image index, sorted
+	OSes []string
+}
+
+func (e *PlatformError) Error() string {
+	return fmt.Sprintf("image %s has no image for platform %s, only for OS %v", e.Image, e.Platform.String(), e.OSes)
 }
 
 // Registry impl
@@ -48,22 +61,26 @@ type Registry struct {
 	dockerConfigJSONKey             string
 	defaultImagePullSecret          string
 	defaultImagePullSecretNamespace string
+	defaultPlatform                 v1.Platform
 }
 
 // NewRegistry creates and initializes registry
-func NewRegistry(skipVerify bool, configJSONKey, imagePullSecret, imagePullSecretNamespace string) ImageRegistry {
+func NewRegistry(skipVerify bool, configJSONKey, imagePullSecret, imagePullSecretNamespace string, defaultPlatform v1.Platform) ImageRegistry {
 	return &Registry{
 		imageCache:                      NewInMemoryImageCache(),
 		registrySkipVerify:              skipVerify,
 		dockerConfigJSONKey:             configJSONKey,
 		defaultImagePullSecret:          imagePullSecret,
 		defaultImagePullSecretNamespace: imagePullSecretNamespace,
+		defaultPlatform:                 defaultPlatform,
 	}
 }
 
-// GetImageConfig returns entrypoint and command of container
-func (r *Registry) GetImageConfig(ctx context.Context, client kubernetes.Interface, namespace string, container *corev1.Container, podSpec *corev1.PodSpec) (*v1.Config, error) {
-	if imageConfig := r.imageCache.Get(container.Image); imageConfig != nil {
+// GetImageConfig returns image config (OS, entrypoint and command) of container;
+// for multi-arch image, config of the platform of nodes the pod can be scheduled on is returned
+func (r *Registry) GetImageConfig(ctx context.Context, client kubernetes.Interface, namespace string, container *corev1.Container, podSpec *corev1.PodSpec) (*v1.ConfigFile, error) {
+	platform := PodPlatform(podSpec, r.defaultPlatform)
+	if imageConfig := r.imageCache.Get(container.Image, platform); imageConfig != nil {
 		return imageConfig, nil
 	}
 
@@ -81,9 +98,9 @@ func (r *Registry) GetImageConfig(ctx context.Context, client kubernetes.Interfa
 		return nil, err
 	}
 
-	imageConfig, err := getImageConfig(ctx, keychain, container.Image, r.registrySkipVerify)
+	imageConfig, err := getImageConfig(ctx, keychain, container.Image, platform, r.registrySkipVerify)
 	if imageConfig != nil {
-		r.imageCache.Put(container.Image, imageConfig)
+		r.imageCache.Put(container.Image, platform, imageConfig)
 	}
 
 	return imageConfig, err
@@ -123,11 +140,12 @@ func (r *Registry) getKeychain(ctx context.Context, client kubernetes.Interface,
 	return keychain, nil
 }
 
-// getImageConfig download image blob from registry
-func getImageConfig(ctx context.Context, keychain authn.Keychain, imageRef string, registrySkipVerify bool) (*v1.Config, error) {
+// getImageConfig download image blob from registry; image index is resolved to the image of platform
+func getImageConfig(ctx context.Context, keychain authn.Keychain, imageRef string, platform v1.Platform, registrySkipVerify bool) (*v1.ConfigFile, error) {
 	options := []remote.Option{
 		remote.WithAuthFromKeychain(keychain),
 		remote.WithContext(ctx),
+		remote.WithPlatform(platform),
 	}
 
 	if registrySkipVerify {
@@ -149,7 +167,10 @@ func getImageConfig(ctx context.Context, keychain authn.Keychain, imageRef strin
 
 	image, err := descriptor.Image()
 	if err != nil {
-		return nil, fmt.Errorf("cannot convert image descriptor to v1.Image: %w", err)
+		if oses := indexOSes(descriptor); len(oses) > 0 && !containsString(oses, platform.OS) {
+			return nil, &PlatformError{Image: imageRef, Platform: platform, OSes: oses}
+		}
+		return nil, fmt.Errorf("cannot convert image descriptor to v1.Image for platform %s: %w", platform.String(), err)
 	}
 
 	configFile, err := image.ConfigFile()
@@ -157,7 +178,35 @@ func getImageConfig(ctx context.Context, keychain authn.Keychain, imageRef strin
 		return nil, fmt.Errorf("cannot extract config file of image: %w", err)
 	}
 
-	return &configFile.Config, nil
+	return configFile, nil
+}
+
+// indexOSes returns OS of images in image index, sorted; nil if descriptor is not an image index
+func indexOSes(descriptor *remote.Descriptor) []string {
+	if !descriptor.MediaType.IsIndex() {
+		return nil
+	}
+	index, err := descriptor.ImageIndex()
+	if err != nil {
+		return nil
+	}
+	manifest, err := index.IndexManifest()
+	if err != nil {
+		return nil
+	}
+	var oses []string
+	for _, child := range manifest.Manifests {
+		// child without platform is linux, as in remote.Descriptor.Image
+		os := "linux"
+		if child.Platform != nil {
+			os = child.Platform.OS
+		}
+		if !containsString(oses, os) {
+			oses = append(oses, os)
+		}
+	}
+	sort.Strings(oses)
+	return oses
 }
 
 // containerInfo keeps information retrieved from POD based container definition
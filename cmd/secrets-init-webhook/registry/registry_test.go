@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-containerregistry/pkg/authn"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// helper function - serve multi-arch image with per platform entrypoint from fake registry
+func serveMultiArchImage(t *testing.T, entrypoints map[string]string) string {
+	objects := map[string][]byte{}
+	mediaTypes := map[string]types.MediaType{}
+	// put stores object under its digest and returns its descriptor
+	put := func(prefix string, mediaType types.MediaType, object interface{}) v1.Descriptor {
+		raw, err := json.Marshal(object)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digest, size, err := v1.SHA256(bytes.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		objects[prefix+digest.String()] = raw
+		mediaTypes[prefix+digest.String()] = mediaType
+		return v1.Descriptor{MediaType: mediaType, Digest: digest, Size: size}
+	}
+
+	index := v1.IndexManifest{SchemaVersion: 2, MediaType: types.OCIImageIndex}
+	for platform, entrypoint := range entrypoints {
+		p, err := ParsePlatform(platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := put("blobs/", types.OCIConfigJSON, v1.ConfigFile{
+			OS:           p.OS,
+			Architecture: p.Architecture,
+			Config:       v1.Config{Entrypoint: []string{entrypoint}},
+		})
+		manifest := put("manifests/", types.OCIManifestSchema1, v1.Manifest{
+			SchemaVersion: 2,
+			MediaType:     types.OCIManifestSchema1,
+			Config:        config,
+			Layers:        []v1.Descriptor{},
+		})
+		manifest.Platform = p
+		index.Manifests = append(index.Manifests, manifest)
+	}
+	tag := put("manifests/", types.OCIImageIndex, index)
+	objects["manifests/latest"] = objects["manifests/"+tag.Digest.String()]
+	mediaTypes["manifests/latest"] = types.OCIImageIndex
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		object := strings.TrimPrefix(r.URL.Path, "/v2/test/multi-arch/")
+		raw, ok := objects[object]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", string(mediaTypes[object]))
+		w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(raw)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://") + "/test/multi-arch:latest"
+}
+
+func Test_getImageConfig(t *testing.T) {
+	image := serveMultiArchImage(t, map[string]string{
+		"linux/amd64":    "/amd64-entrypoint",
+		"linux/arm64/v8": "/arm64-entrypoint",
+	})
+	tests := []struct {
+		name     string
+		platform v1.Platform
+		want     []string
+		wantErr  bool
+		// wantOSErrors OS of images in the index reported by PlatformError; no PlatformError if nil
+		wantOSErrors []string
+	}{
+		{
+			name:     "amd64",
+			platform: v1.Platform{OS: "linux", Architecture: "amd64"},
+			want:     []string{"/amd64-entrypoint"},
+		},
+		{
+			name:     "arm64 without variant",
+			platform: v1.Platform{OS: "linux", Architecture: "arm64"},
+			want:     []string{"/arm64-entrypoint"},
+		},
+		{
+			name:     "missing architecture",
+			platform: v1.Platform{OS: "linux", Architecture: "s390x"},
+			wantErr:  true,
+		},
+		{
+			name:         "missing OS",
+			platform:     v1.Platform{OS: "windows", Architecture: "amd64"},
+			wantErr:      true,
+			wantOSErrors: []string{"linux"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := getImageConfig(context.TODO(), authn.DefaultKeychain, image, tt.platform, false)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("getImageConfig() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			var platformErr *PlatformError
+			if errors.As(err, &platformErr) != (tt.wantOSErrors != nil) {
+				t.Errorf("getImageConfig() error = %v, want PlatformError %v", err, tt.wantOSErrors != nil)
+			} else if platformErr != nil && !reflect.DeepEqual(platformErr.OSes, tt.wantOSErrors) {
+				t.Errorf("getImageConfig() PlatformError OSes = %v, want %v", platformErr.OSes, tt.wantOSErrors)
+			}
+			if err == nil && !reflect.DeepEqual(got.Config.Entrypoint, tt.want) {
+				t.Errorf("getImageConfig() entrypoint = %v, want %v", got.Config.Entrypoint, tt.want)
+			}
+		})
+	}
+}
+
+func TestInMemoryImageCache(t *testing.T) {
+	cache := NewInMemoryImageCache()
+	amd64 := v1.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := v1.Platform{OS: "linux", Architecture: "arm64"}
+	cache.Put("image", amd64, &v1.ConfigFile{Config: v1.Config{Entrypoint: []string{"amd64"}}})
+	if got := cache.Get("image", arm64); got != nil {
+		t.Errorf("InMemoryImageCache.Get() = %v for another platform, want nil", got)
+	}
+	if got := cache.Get("image", amd64); got == nil || !reflect.DeepEqual(got.Config.Entrypoint, []string{"amd64"}) {
+		t.Errorf("InMemoryImageCache.Get() = %v, want amd64 entrypoint", got)
+	}
+}
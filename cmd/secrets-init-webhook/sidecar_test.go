@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	log "github.com/sirupsen/logrus"
+	whlogrus "github.com/slok/kubewebhook/v2/pkg/log/logrus"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	"github.com/slok/kubewebhook/v2/pkg/webhook/mutating"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// sidecarTestPod pod JSON with ordinary init container, native sidecar and container referencing testSecretARN
+const sidecarTestPod = `{
+  "apiVersion": "v1",
+  "kind": "Pod",
+  "metadata": {"name": "test-pod", "namespace": "test-ns"},
+  "spec": {
+    "initContainers": [
+      {"name": "init", "image": "init", "command": ["init"], "env": [{"name": "PASSWORD", "value": "` + testSecretARN + `"}]},
+      {
+        "name": "sidecar", "image": "sidecar", "command": ["proxy"], "restartPolicy": "Always",
+        "env": [{"name": "PASSWORD", "value": "` + testSecretARN + `"}],
+        "startupProbe": {"httpGet": {"path": "/ready", "port": 8080}, "periodSeconds": 1}
+      }
+    ],
+    "containers": [
+      {"name": "app", "image": "app", "command": ["app"], "env": [{"name": "PASSWORD", "value": "` + testSecretARN + `"}]}
+    ]
+  }
+}`
+
+// helper function - review pod with pods webhook and apply returned JSON patch
+func reviewPod(t *testing.T, mw *mutatingWebhook, raw []byte) []byte {
+	t.Helper()
+	webhook, err := mutating.NewWebhook(mutating.WebhookConfig{
+		ID:      "test",
+		Obj:     &corev1.Pod{},
+		Mutator: mutating.MutatorFunc(mw.secretsMutator),
+		Logger:  whlogrus.NewLogrus(log.NewEntry(logger)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	response, err := webhook.Review(context.TODO(), whmodel.AdmissionReview{
+		Namespace:    "test-ns",
+		Operation:    whmodel.OperationCreate,
+		NewObjectRaw: raw,
+	})
+	if err != nil {
+		t.Fatalf("webhook.Review() error = %v", err)
+	}
+	patch, err := jsonpatch.DecodePatch(response.(*whmodel.MutatingAdmissionResponse).JSONPatchPatch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patched, err := patch.Apply(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return patched
+}
+
+type sidecarTestContainer struct {
+	Name          string            `json:"name"`
+	Command       []string          `json:"command"`
+	RestartPolicy string            `json:"restartPolicy"`
+	StartupProbe  *corev1.Probe     `json:"startupProbe"`
+	Env           []json.RawMessage `json:"env"`
+}
+
+// helper function - decode init containers of pod JSON
+func decodeInitContainers(t *testing.T, raw []byte) []sidecarTestContainer {
+	t.Helper()
+	var pod struct {
+		Spec struct {
+			InitContainers []sidecarTestContainer `json:"initContainers"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(raw, &pod); err != nil {
+		t.Fatal(err)
+	}
+	return pod.Spec.InitContainers
+}
+
+func Test_mutatingWebhook_secretsMutator_sidecars(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+	wrapped := []string{binVolumePath + "/secrets-init"}
+
+	// first admission
+	patched := reviewPod(t, mw, []byte(sidecarTestPod))
+	initContainers := decodeInitContainers(t, patched)
+	var names []string
+	for _, c := range initContainers {
+		names = append(names, c.Name)
+	}
+	if want := []string{secretsInitContainerName, "init", "sidecar"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("init containers = %v, want %v", names, want)
+	}
+	sidecar := initContainers[2]
+	if sidecar.RestartPolicy != "Always" || sidecar.StartupProbe == nil || sidecar.StartupProbe.HTTPGet.Path != "/ready" {
+		t.Errorf("sidecar restartPolicy or probe is lost: %+v", sidecar)
+	}
+	if !reflect.DeepEqual(sidecar.Command, wrapped) || !reflect.DeepEqual(initContainers[1].Command, wrapped) {
+		t.Errorf("init containers are not wrapped: %+v", initContainers)
+	}
+	if initContainers[1].RestartPolicy != "" {
+		t.Errorf("ordinary init container restartPolicy = %q, want none", initContainers[1].RestartPolicy)
+	}
+
+	// another webhook places a new sidecar ahead of secrets-init init container, webhook is reinvoked
+	var pod map[string]interface{}
+	if err := json.Unmarshal(patched, &pod); err != nil {
+		t.Fatal(err)
+	}
+	spec, _ := pod["spec"].(map[string]interface{})
+	spec["initContainers"] = append([]interface{}{map[string]interface{}{
+		"name": "injected", "image": "injected", "command": []string{"injected"}, "restartPolicy": "Always",
+		"env": []map[string]string{{"name": "TOKEN", "value": testSecretARN}},
+	}}, spec["initContainers"].([]interface{})...)
+	reinvoked, err := json.Marshal(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	initContainers = decodeInitContainers(t, reviewPod(t, mw, reinvoked))
+	names = nil
+	var policies []string
+	for _, c := range initContainers {
+		names = append(names, c.Name)
+		policies = append(policies, c.RestartPolicy)
+	}
+	if want := []string{secretsInitContainerName, "injected", "init", "sidecar"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("reinvoked init containers = %v, want %v", names, want)
+	}
+	if want := []string{"", "Always", "", "Always"}; !reflect.DeepEqual(policies, want) {
+		t.Errorf("reinvoked init containers restartPolicy = %v, want %v", policies, want)
+	}
+	if !reflect.DeepEqual(initContainers[1].Command, wrapped) {
+		t.Errorf("injected sidecar is not wrapped: %+v", initContainers[1])
+	}
+}
+
+func Test_mutatingWebhook_secretsMutator_keepsPodFields(t *testing.T) {
+	mw := &mutatingWebhook{
+		k8sClient:  fake.NewSimpleClientset(),
+		registry:   &MockRegistry{Image: v1.Config{}},
+		provider:   "aws",
+		image:      secretsInitImage,
+		volumeName: binVolumeName,
+		volumePath: binVolumePath,
+	}
+	raw := `{
+  "apiVersion": "v1",
+  "kind": "Pod",
+  "metadata": {"name": "test-pod", "namespace": "test-ns"},
+  "spec": {
+    "hostUsers": false,
+    "schedulingGates": [{"name": "example.com/quota"}],
+    "resourceClaims": [{"name": "gpu", "resourceClaimName": "gpu-claim"}],
+    "containers": [
+      {
+        "name": "app", "image": "app", "command": ["app"], "env": [{"name": "PASSWORD", "value": "` + testSecretARN + `"}],
+        "resizePolicy": [{"resourceName": "cpu", "restartPolicy": "NotRequired"}]
+      }
+    ]
+  }
+}`
+	var pod struct {
+		Spec struct {
+			HostUsers       *bool             `json:"hostUsers"`
+			SchedulingGates []json.RawMessage `json:"schedulingGates"`
+			ResourceClaims  []json.RawMessage `json:"resourceClaims"`
+			Containers      []struct {
+				Command      []string          `json:"command"`
+				ResizePolicy []json.RawMessage `json:"resizePolicy"`
+			} `json:"containers"`
+		} `json:"spec"`
+	}
+	if err := json.Unmarshal(reviewPod(t, mw, []byte(raw)), &pod); err != nil {
+		t.Fatal(err)
+	}
+	if pod.Spec.HostUsers == nil || len(pod.Spec.SchedulingGates) != 1 || len(pod.Spec.ResourceClaims) != 1 {
+		t.Errorf("pod fields are lost: %+v", pod.Spec)
+	}
+	app := pod.Spec.Containers[0]
+	if len(app.ResizePolicy) != 1 {
+		t.Errorf("container resizePolicy is lost: %+v", app)
+	}
+	if want := []string{binVolumePath + "/secrets-init"}; !reflect.DeepEqual(app.Command, want) {
+		t.Errorf("container is not wrapped: %+v", app)
+	}
+}
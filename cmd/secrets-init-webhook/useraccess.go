@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// object access modes: whose permissions are used to read ConfigMaps and Secrets referenced by pod env
+const (
+	// objectAccessWebhook objects are read with the webhook permissions
+	objectAccessWebhook = "webhook"
+	// objectAccessImpersonate objects are read impersonating the user that sent the admission request
+	objectAccessImpersonate = "impersonate"
+	// objectAccessSubjectAccessReview objects are read, if SubjectAccessReview allows the user to get them
+	objectAccessSubjectAccessReview = "subject-access-review"
+)
+
+var (
+	// ErrInvalidObjectAccess unknown object access mode
+	ErrInvalidObjectAccess = errors.New("invalid object access mode")
+	// ErrNoAdmissionUser admission request user is required to read objects
+	ErrNoAdmissionUser = errors.New("no admission request user")
+)
+
+func isObjectAccess(mode string) bool {
+	return mode == objectAccessWebhook || mode == objectAccessImpersonate || mode == objectAccessSubjectAccessReview
+}
+
+// impersonatingClientFunc returns function creating client that impersonates the user
+func impersonatingClientFunc(config *rest.Config) func(user *authenticationv1.UserInfo) (kubernetes.Interface, error) {
+	return func(user *authenticationv1.UserInfo) (kubernetes.Interface, error) {
+		impersonating := rest.CopyConfig(config)
+		impersonating.Impersonate = rest.ImpersonationConfig{
+			UserName: user.Username,
+			UID:      user.UID,
+			Groups:   user.Groups,
+			Extra:    map[string][]string{},
+		}
+		for key, value := range user.Extra {
+			impersonating.Impersonate.Extra[key] = value
+		}
+		client, err := kubernetes.NewForConfig(impersonating)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to create client impersonating %s", user.Username)
+		}
+		return client, nil
+	}
+}
+
+// admissionUserInfo returns user that sent the admission request; nil for unknown admission review version
+func admissionUserInfo(ar *whmodel.AdmissionReview) *authenticationv1.UserInfo {
+	switch review := ar.OriginalAdmissionReview.(type) {
+	case *admissionv1.AdmissionReview:
+		return &review.Request.UserInfo
+	case *admissionv1beta1.AdmissionReview:
+		return &review.Request.UserInfo
+	default:
+		return nil
+	}
+}
+
+// admissionUser user that sent the admission request, with impersonating client created on first use
+type admissionUser struct {
+	info   *authenticationv1.UserInfo
+	client kubernetes.Interface
+}
+
+type admissionUserKey struct{}
+
+// withAdmissionUser returns context with user that sent the admission request
+func withAdmissionUser(ctx context.Context, user *authenticationv1.UserInfo) context.Context {
+	if user == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, admissionUserKey{}, &admissionUser{info: user})
+}
+
+func admissionUserFrom(ctx context.Context) (*admissionUser, error) {
+	user, ok := ctx.Value(admissionUserKey{}).(*admissionUser)
+	if !ok {
+		return nil, ErrNoAdmissionUser
+	}
+	return user, nil
+}
+
+// objectClient returns client to read objects with; impersonates the admission request user, if configured
+func (mw *mutatingWebhook) objectClient(ctx context.Context) (kubernetes.Interface, error) {
+	if mw.objectAccess != objectAccessImpersonate {
+		return mw.k8sClient, nil
+	}
+	user, err := admissionUserFrom(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if user.client == nil {
+		if user.client, err = mw.impersonate(user.info); err != nil {
+			return nil, err
+		}
+	}
+	return user.client, nil
+}
+
+// checkObjectAccess checks the admission request user can get the object with SubjectAccessReview, if configured;
+// returns Forbidden error otherwise
+func (mw *mutatingWebhook) checkObjectAccess(ctx context.Context, resource schema.GroupResource, name, ns string) error {
+	if mw.objectAccess != objectAccessSubjectAccessReview {
+		return nil
+	}
+	user, err := admissionUserFrom(ctx)
+	if err != nil {
+		return err
+	}
+	review := &authorizationv1.SubjectAccessReview{
+		Spec: authorizationv1.SubjectAccessReviewSpec{
+			ResourceAttributes: &authorizationv1.ResourceAttributes{
+				Namespace: ns,
+				Verb:      "get",
+				Group:     resource.Group,
+				Resource:  resource.Resource,
+				Name:      name,
+			},
+			User:   user.info.Username,
+			UID:    user.info.UID,
+			Groups: user.info.Groups,
+			Extra:  map[string]authorizationv1.ExtraValue{},
+		},
+	}
+	for key, value := range user.info.Extra {
+		review.Spec.Extra[key] = authorizationv1.ExtraValue(value)
+	}
+	review, err = mw.k8sClient.AuthorizationV1().SubjectAccessReviews().Create(ctx, review, metav1.CreateOptions{})
+	if err != nil {
+		return errors.Wrapf(err, "failed to review %s access to %s %s/%s", user.info.Username, resource.Resource, ns, name)
+	}
+	if !review.Status.Allowed {
+		return apierrors.NewForbidden(resource, name, errors.Errorf("user %q cannot get %s in namespace %q", user.info.Username, resource.Resource, ns))
+	}
+	return nil
+}
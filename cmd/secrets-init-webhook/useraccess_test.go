@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/pkg/errors"
+	whmodel "github.com/slok/kubewebhook/v2/pkg/model"
+	admissionv1 "k8s.io/api/admission/v1"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func Test_admissionUserInfo(t *testing.T) {
+	user := authenticationv1.UserInfo{Username: "alice", Groups: []string{"dev"}}
+	tests := []struct {
+		name   string
+		review runtime.Object
+		want   *authenticationv1.UserInfo
+	}{
+		{
+			name:   "admission/v1",
+			review: &admissionv1.AdmissionReview{Request: &admissionv1.AdmissionRequest{UserInfo: user}},
+			want:   &user,
+		},
+		{
+			name:   "admission/v1beta1",
+			review: &admissionv1beta1.AdmissionReview{Request: &admissionv1beta1.AdmissionRequest{UserInfo: user}},
+			want:   &user,
+		},
+		{
+			name: "unknown review",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := admissionUserInfo(&whmodel.AdmissionReview{OriginalAdmissionReview: tt.review}); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("admissionUserInfo() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_mutatingWebhook_getDataFromSecret_impersonate(t *testing.T) {
+	webhookClient := fake.NewSimpleClientset(
+		makeSecret("test-ns", "visible", map[string][]byte{"password": []byte(testSecretARN)}),
+		makeSecret("test-ns", "hidden", map[string][]byte{"password": []byte(testSecretARN)}),
+	)
+	userClient := fake.NewSimpleClientset(
+		makeSecret("test-ns", "visible", map[string][]byte{"password": []byte(testSecretARN)}),
+	)
+	var impersonated []string
+	mw := &mutatingWebhook{
+		k8sClient:    webhookClient,
+		objectAccess: objectAccessImpersonate,
+		impersonate: func(user *authenticationv1.UserInfo) (kubernetes.Interface, error) {
+			impersonated = append(impersonated, user.Username)
+			return userClient, nil
+		},
+	}
+	ctx := withAdmissionUser(context.TODO(), &authenticationv1.UserInfo{Username: "alice"})
+
+	if _, err := mw.getDataFromSecret(ctx, "visible", "test-ns"); err != nil {
+		t.Errorf("mutatingWebhook.getDataFromSecret() error = %v", err)
+	}
+	if _, err := mw.getDataFromSecret(ctx, "hidden", "test-ns"); !apierrors.IsNotFound(errors.Cause(err)) {
+		t.Errorf("mutatingWebhook.getDataFromSecret() error = %v, want NotFound", err)
+	}
+	if !reflect.DeepEqual(impersonated, []string{"alice"}) {
+		t.Errorf("impersonated users = %v, want [alice]", impersonated)
+	}
+	if gets := countGets(webhookClient, "secrets"); gets != 0 {
+		t.Errorf("webhook client GETs = %d, want 0", gets)
+	}
+	if _, err := mw.getDataFromSecret(context.TODO(), "visible", "test-ns"); !errors.Is(err, ErrNoAdmissionUser) {
+		t.Errorf("mutatingWebhook.getDataFromSecret() error = %v, want %v", err, ErrNoAdmissionUser)
+	}
+}
+
+func Test_mutatingWebhook_getDataFromConfigmap_subjectAccessReview(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		makeConfigMap("test-ns", "allowed", map[string]string{"password": testSecretARN}),
+		makeConfigMap("test-ns", "denied", map[string]string{"password": testSecretARN}),
+	)
+	var reviews []authorizationv1.SubjectAccessReviewSpec
+	client.PrependReactor("create", "subjectaccessreviews", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		review := action.(k8stesting.CreateAction).GetObject().(*authorizationv1.SubjectAccessReview)
+		reviews = append(reviews, review.Spec)
+		review.Status.Allowed = review.Spec.User == "alice" && review.Spec.ResourceAttributes.Name == "allowed"
+		return true, review, nil
+	})
+	mw := &mutatingWebhook{k8sClient: client, objectAccess: objectAccessSubjectAccessReview}
+	ctx := withAdmissionUser(context.TODO(), &authenticationv1.UserInfo{Username: "alice", Groups: []string{"dev"}})
+
+	got, err := mw.getDataFromConfigmap(ctx, "allowed", "test-ns")
+	if err != nil || got["password"] != testSecretARN {
+		t.Errorf("mutatingWebhook.getDataFromConfigmap() = %v, %v", got, err)
+	}
+	if _, err = mw.getDataFromConfigmap(ctx, "denied", "test-ns"); !apierrors.IsForbidden(errors.Cause(err)) {
+		t.Errorf("mutatingWebhook.getDataFromConfigmap() error = %v, want Forbidden", err)
+	}
+	if gets := countGets(client, "configmaps"); gets != 1 {
+		t.Errorf("mutatingWebhook.getDataFromConfigmap() GETs = %d, want 1", gets)
+	}
+	want := authorizationv1.SubjectAccessReviewSpec{
+		ResourceAttributes: &authorizationv1.ResourceAttributes{Namespace: "test-ns", Verb: "get", Resource: "configmaps", Name: "denied"},
+		User:               "alice",
+		Groups:             []string{"dev"},
+		Extra:              map[string]authorizationv1.ExtraValue{},
+	}
+	if len(reviews) != 2 || !reflect.DeepEqual(reviews[1], want) {
+		t.Errorf("SubjectAccessReviews = %+v, want second %+v", reviews, want)
+	}
+}